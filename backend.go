@@ -0,0 +1,127 @@
+package elasticbook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gopkg.in/olivere/elastic.v3"
+)
+
+// Backend is where the bookmarks are indexed and searched: an
+// Elasticsearch cluster (the Client) or an engine embedded on the local
+// disk (see the embedded package).
+// The indices are timestamped (see NewIndexName) and the searches go
+// through the default alias (see AliasName).
+// Every operation takes a context: when it is done, the operation stops
+// and returns ctx.Err().
+type Backend interface {
+	// IndexContext builds a new index from the sources
+	IndexContext(ctx context.Context, ss ...*Source) (*IndexReport, error)
+	// SearchWithContext looks for bookmarks in the default index
+	SearchWithContext(ctx context.Context, term string, o SearchOptions) (*SearchResult, error)
+	// SuggestContext completes the bookmark names starting with term
+	SuggestContext(ctx context.Context, term string) ([]string, error)
+	// ScanContext visits all the bookmarks of an index (or an alias)
+	ScanContext(ctx context.Context, name string, fn func(id string, b *BookmarkIndexable) error) error
+
+	// IndexNamesContext returns the index names, sorted
+	IndexNamesContext(ctx context.Context) ([]string, error)
+	// IndicesContext returns the index names, with their document count
+	IndicesContext(ctx context.Context) ([]string, error)
+	// AliasesContext returns the index names, with their count and aliases
+	AliasesContext(ctx context.Context) ([]string, error)
+	// AliasContext adds an alias to an index (ErrAliasConflict if it is
+	// already taken)
+	AliasContext(ctx context.Context, indexName string, aliasName string) (bool, error)
+	// UnaliasContext removes an alias
+	UnaliasContext(ctx context.Context, aliasName string) (bool, error)
+	// DefaultContext points the default alias to an index
+	DefaultContext(ctx context.Context, indexName string) (bool, error)
+	// DeleteContext drops an index
+	DeleteContext(ctx context.Context, indexName string) error
+
+	// AliasName returns the default alias
+	AliasName() string
+	// URL tells where the backend lives
+	URL() string
+}
+
+// Client is the Elasticsearch Backend
+var _ Backend = (*Client)(nil)
+
+// SearchResult is what a search found: a page of the hits (see Pager)
+type SearchResult struct {
+	TookInMillis int64
+	TotalHits    int64
+	Hits         []*SearchHit
+
+	// Page and Size are the page returned
+	Page int
+	Size int
+	// Next and Prev are the cursors of the adjacent pages (empty if there
+	// is none), to be set in SearchOptions.Cursor
+	Next string
+	Prev string
+}
+
+// SearchHit is a bookmark found, with its score
+type SearchHit struct {
+	ID       string
+	Score    float64
+	Bookmark *BookmarkIndexable
+	// Explanation is how the score has been computed (it depends on the
+	// Backend)
+	Explanation interface{}
+}
+
+// newSearchResult converts an Elasticsearch result
+func newSearchResult(sr *elastic.SearchResult) (*SearchResult, error) {
+	r := &SearchResult{TookInMillis: sr.TookInMillis}
+	if sr.Hits == nil {
+		return r, nil
+	}
+
+	r.TotalHits = sr.Hits.TotalHits
+	for _, hit := range sr.Hits.Hits {
+		b := new(BookmarkIndexable)
+		if err := json.Unmarshal(*hit.Source, b); err != nil {
+			return nil, err
+		}
+		h := &SearchHit{ID: hit.Id, Bookmark: b}
+		if hit.Score != nil {
+			h.Score = *hit.Score
+		}
+		if hit.Explanation != nil {
+			h.Explanation = *hit.Explanation
+		}
+		r.Hits = append(r.Hits, h)
+	}
+	return r, nil
+}
+
+// Documents visits every URL node of the tree as it is indexed, with its
+// document ID (see ID). If a node cannot be converted (e.g.
+// ErrUnparseableDate), fn gets the error instead of the bookmark.
+func (s *Source) Documents(fn func(id string, b *BookmarkIndexable, err error)) {
+	s.Walk(func(b *Bookmark, l Location) {
+		bs, err := b.toIndexable(l)
+		fn(s.ID(b), bs, err)
+	})
+}
+
+// NewIndexName returns a timestamped index name, like
+// "elasticbook-20160111213240"
+func NewIndexName() string {
+	return newIndexName(DefaultIndexName)
+}
+
+// newIndexName returns a timestamped index name with the given prefix
+func newIndexName(prefix string) string {
+	t := time.Now().UTC()
+	s := fmt.Sprintf("%d%02d%02d%02d%02d%02d",
+		t.Year(), t.Month(), t.Day(),
+		t.Hour(), t.Minute(), t.Second())
+	return fmt.Sprintf("%s-%s", prefix, s)
+}
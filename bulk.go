@@ -0,0 +1,87 @@
+package elasticbook
+
+import (
+	"encoding/json"
+
+	"gopkg.in/olivere/elastic.v3"
+)
+
+// IndexReport collects the outcome of an Index run
+type IndexReport struct {
+	// IndexName is the index built (or deleted, if Aborted and not kept)
+	IndexName string
+	// Succeeded contains the document IDs of the indexed bookmarks (the
+	// Chrome IDs, prefixed with the Source if tagged)
+	Succeeded []string
+	// Failed contains the bookmarks the cluster refused (or never received)
+	Failed []IndexFailure
+	// Aborted is true if the failure threshold has been exceeded
+	Aborted bool
+}
+
+// IndexFailure is a bookmark not indexed, with the reason why
+type IndexFailure struct {
+	ID     string
+	Reason string
+}
+
+// collect records the outcome of a bulk request.
+// If the whole request failed, every bookmark in it is marked as failed.
+func (r *IndexReport) collect(rs []elastic.BulkableRequest, resp *elastic.BulkResponse, err error) {
+	if err != nil || resp == nil {
+		reason := "no bulk response"
+		if err != nil {
+			reason = err.Error()
+		}
+		for _, x := range rs {
+			r.Failed = append(r.Failed, IndexFailure{
+				ID:     bulkRequestID(x),
+				Reason: reason,
+			})
+		}
+		return
+	}
+
+	for _, items := range resp.Items {
+		for _, item := range items {
+			if item.Error == nil && item.Status < 300 {
+				r.Succeeded = append(r.Succeeded, item.Id)
+				continue
+			}
+			reason := "unknown error"
+			if item.Error != nil {
+				reason = item.Error.Type + ": " + item.Error.Reason
+			}
+			r.Failed = append(r.Failed, IndexFailure{
+				ID:     item.Id,
+				Reason: reason,
+			})
+		}
+	}
+}
+
+// exceeds returns true if the failures are more than the max allowed.
+// A negative max means "never".
+func (r *IndexReport) exceeds(max int) bool {
+	return max >= 0 && len(r.Failed) > max
+}
+
+// bulkRequestID extracts the document ID from the action line of a bulk
+// request, e.g. {"index":{"_id":"42","_index":"...","_type":"bookmark"}}
+func bulkRequestID(r elastic.BulkableRequest) string {
+	lines, err := r.Source()
+	if err != nil || len(lines) == 0 {
+		return ""
+	}
+
+	var action map[string]struct {
+		ID string `json:"_id"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &action); err != nil {
+		return ""
+	}
+	for _, v := range action {
+		return v.ID
+	}
+	return ""
+}
@@ -0,0 +1,258 @@
+package elasticbook
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+	"unicode/utf16"
+)
+
+// ErrChecksumMismatch is returned by Parse when the checksum of the
+// Bookmarks file is not the one Chrome would compute (the tree is
+// returned anyway)
+var ErrChecksumMismatch = errors.New("checksum mismatch: the Bookmarks file may be corrupted")
+
+// BackupSuffix is appended to the name of a Bookmarks file replaced by
+// WriteFile (Chrome uses the same "Bookmarks.bak")
+const BackupSuffix = ".bak"
+
+// chromeEpochDelta are the seconds between 1601-01-01 (Chrome epoch) and
+// 1970-01-01 (Unix epoch)
+const chromeEpochDelta = 11644473600
+
+// chromeTimestamp formats t the way Chrome does: microseconds since
+// 1601-01-01 UTC
+func chromeTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	us := (t.Unix()+chromeEpochDelta)*1000000 + int64(t.Nanosecond()/1000)
+	return strconv.FormatInt(us, 10)
+}
+
+// ComputeChecksum returns the MD5 checksum Chrome stores in the Bookmarks
+// file: the id, the name (UTF-16) and the url of every node, depth-first,
+// with the root folders in the bookmark_bar, other, synced order
+func (r *Root) ComputeChecksum() string {
+	h := md5.New()
+	for _, b := range []*Base{&r.Roots.BookmarkBar, &r.Roots.Other, &r.Roots.Synced} {
+		sumFolder(h, b.ID, b.Name)
+		sumNodes(h, b.Children)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify returns ErrChecksumMismatch if the checksum is not valid
+func (r *Root) Verify() error {
+	if r.Checksum != r.ComputeChecksum() {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+func sumNodes(h hash.Hash, bs []Bookmark) {
+	for i := range bs {
+		b := &bs[i]
+		if b.IsFolder() {
+			sumFolder(h, b.OriginalID, b.Name)
+			sumNodes(h, b.Children)
+			continue
+		}
+		h.Write([]byte(b.OriginalID))
+		h.Write(utf16Bytes(b.Name))
+		h.Write([]byte(URLNodeType))
+		h.Write([]byte(b.URL))
+	}
+}
+
+func sumFolder(h hash.Hash, id string, name string) {
+	h.Write([]byte(id))
+	h.Write(utf16Bytes(name))
+	h.Write([]byte(FolderNodeType))
+}
+
+// utf16Bytes encodes s as UTF-16 little endian (Chrome hashes the in
+// memory string16)
+func utf16Bytes(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, x := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], x)
+	}
+	return b
+}
+
+// MarshalJSON writes the node the way Chrome reads it back: a folder
+// always has its children, even if there are none
+func (b Bookmark) MarshalJSON() ([]byte, error) {
+	type node Bookmark
+	if !b.IsFolder() {
+		return json.Marshal(node(b))
+	}
+	children := b.Children
+	if children == nil {
+		children = []Bookmark{}
+	}
+	return json.Marshal(struct {
+		node
+		Children []Bookmark `json:"children"`
+	}{node(b), children})
+}
+
+// Marshal sets a fresh checksum and returns the tree as a Chrome
+// Bookmarks file. The fields elasticbook does not know about are lost.
+func (r *Root) Marshal() ([]byte, error) {
+	for _, b := range r.Roots.Folders() {
+		if b.Children == nil {
+			b.Children = []Bookmark{}
+		}
+	}
+	r.Checksum = r.ComputeChecksum()
+	return json.MarshalIndent(r, "", "   ")
+}
+
+// WriteFile writes the tree (see Marshal) to path. The file is replaced
+// atomically and the previous one, if any, is kept with the BackupSuffix.
+// Close the browser first: Chrome overwrites the file when it exits.
+func (r *Root) WriteFile(path string) error {
+	b, err := r.Marshal()
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0600)
+	old, err := ioutil.ReadFile(path)
+	if err == nil {
+		if fi, err := os.Stat(path); err == nil {
+			mode = fi.Mode()
+		}
+		if err := ioutil.WriteFile(path+BackupSuffix, old, mode); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Tree is an Exporter rebuilding a Bookmarks tree from indexed bookmarks:
+// the folders are created along their Path and every node gets a new ID
+// (the indexed ones may come from several sources)
+type Tree struct {
+	root   *Root
+	nextID int
+}
+
+// NewTree returns an empty Tree, with the root folders only
+func NewTree() *Tree {
+	r := &Root{Version: 1}
+	for i, b := range []*Base{&r.Roots.BookmarkBar, &r.Roots.Other, &r.Roots.Synced} {
+		b.ID = strconv.Itoa(i + 1)
+		b.Children = []Bookmark{}
+		b.DateAdded = "0"
+		b.DataModified = "0"
+		b.NodeType = FolderNodeType
+	}
+	r.Roots.BookmarkBar.Name = "Bookmarks Bar"
+	r.Roots.Other.Name = "Other Bookmarks"
+	r.Roots.Synced.Name = "Mobile Bookmarks"
+	return &Tree{root: r, nextID: 4}
+}
+
+// Write adds a bookmark to the tree
+func (t *Tree) Write(b *BookmarkIndexable) error {
+	base := &t.root.Roots.Other
+	switch b.Root {
+	case BookmarkBarKey:
+		base = &t.root.Roots.BookmarkBar
+	case SyncedKey:
+		base = &t.root.Roots.Synced
+	}
+
+	dateAdded := chromeTimestamp(b.DateAdded)
+	children := &base.Children
+	for i, name := range b.Path {
+		if i == 0 {
+			// the root folder
+			continue
+		}
+		children = t.folder(children, name, dateAdded)
+	}
+
+	*children = append(*children, Bookmark{
+		DateAdded:    dateAdded,
+		DateModified: b.DateModified,
+		OriginalID:   t.id(),
+		Keyword:      b.Keyword,
+		Name:         b.Name,
+		Tags:         b.Tags,
+		Type:         URLNodeType,
+		URL:          b.URL,
+	})
+	return nil
+}
+
+// folder returns the children of the folder named name, creating it if
+// needed
+func (t *Tree) folder(children *[]Bookmark, name string, dateAdded string) *[]Bookmark {
+	for i := range *children {
+		if b := &(*children)[i]; b.IsFolder() && b.Name == name {
+			return &b.Children
+		}
+	}
+	*children = append(*children, Bookmark{
+		Children:     []Bookmark{},
+		DateAdded:    dateAdded,
+		DateModified: "0",
+		OriginalID:   t.id(),
+		Name:         name,
+		Type:         FolderNodeType,
+	})
+	return &(*children)[len(*children)-1].Children
+}
+
+func (t *Tree) id() string {
+	id := strconv.Itoa(t.nextID)
+	t.nextID++
+	return id
+}
+
+// Close sets the checksum of the tree
+func (t *Tree) Close() error {
+	t.root.Checksum = t.root.ComputeChecksum()
+	return nil
+}
+
+// Root returns the tree built so far
+func (t *Tree) Root() *Root {
+	return t.root
+}
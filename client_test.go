@@ -0,0 +1,776 @@
+package elasticbook_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/zeroed/elasticbook"
+	"github.com/zeroed/elasticbook/estest"
+)
+
+// newClient returns a Client talking to the fake server
+func newClient(t *testing.T, s *estest.Server, options ...elasticbook.ClientOptionFunc) *elasticbook.Client {
+	ec, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := elasticbook.NewClient(append([]elasticbook.ClientOptionFunc{
+		elasticbook.SetURL(s.URL),
+		elasticbook.SetElasticClient(ec)}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// setup creates the indices with their aliases
+func setup(s *estest.Server, indices map[string][]string) {
+	for n, as := range indices {
+		s.CreateIndex(n)
+		for _, a := range as {
+			s.AddAlias(n, a)
+		}
+	}
+}
+
+// aliases returns the aliases of every index on the server
+func aliases(s *estest.Server) map[string][]string {
+	ia := make(map[string][]string)
+	for _, n := range s.IndexNames() {
+		ia[n] = s.Aliases(n)
+	}
+	return ia
+}
+
+const dateAdded = "13094473600000000"
+
+// newRoot returns a small Bookmarks tree: two bookmarks in the bar (one
+// in the Work folder) and one in the other bookmarks
+func newRoot() *elasticbook.Root {
+	r := new(elasticbook.Root)
+	r.Checksum = "0f0f0f"
+	r.Roots.BookmarkBar = elasticbook.Base{
+		ID:   "1",
+		Name: "Bookmarks Bar",
+		Children: []elasticbook.Bookmark{
+			{OriginalID: "4", Name: "The Go Programming Language", URL: "https://golang.org/", Type: elasticbook.URLNodeType, DateAdded: dateAdded},
+			{OriginalID: "5", Name: "Work", Type: elasticbook.FolderNodeType, DateAdded: dateAdded, Children: []elasticbook.Bookmark{
+				{OriginalID: "6", Name: "Go by Example", URL: "https://gobyexample.com/", Type: elasticbook.URLNodeType, DateAdded: dateAdded},
+			}},
+		},
+	}
+	r.Roots.Other = elasticbook.Base{
+		ID:   "2",
+		Name: "Other Bookmarks",
+		Children: []elasticbook.Bookmark{
+			{OriginalID: "7", Name: "Elasticsearch", URL: "https://www.elastic.co/", Type: elasticbook.URLNodeType, DateAdded: dateAdded},
+		},
+	}
+	r.Roots.Synced = elasticbook.Base{ID: "3", Name: "Mobile Bookmarks"}
+	return r
+}
+
+// badDate returns the newRoot tree with an unparseable date on the
+// "Go by Example" bookmark
+func badDate() *elasticbook.Root {
+	r := newRoot()
+	r.Roots.BookmarkBar.Children[1].Children[0].DateAdded = "yesterday"
+	return r
+}
+
+func TestAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		indices map[string][]string
+		index   string
+		alias   string
+		want    bool
+		wantErr error
+		after   map[string][]string
+	}{
+		{
+			name:    "new alias",
+			indices: map[string][]string{"a": nil},
+			index:   "a",
+			alias:   "foo",
+			want:    true,
+			after:   map[string][]string{"a": {"foo"}},
+		},
+		{
+			name:    "alias taken by another index",
+			indices: map[string][]string{"a": {"foo"}, "b": nil},
+			index:   "b",
+			alias:   "foo",
+			wantErr: elasticbook.ErrAliasConflict,
+			after:   map[string][]string{"a": {"foo"}, "b": nil},
+		},
+		{
+			name:    "missing index",
+			indices: map[string][]string{"a": nil},
+			index:   "b",
+			alias:   "foo",
+			wantErr: elasticbook.ErrIndexNotFound,
+			after:   map[string][]string{"a": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := estest.NewServer()
+			defer s.Close()
+			setup(s, tt.indices)
+
+			got, err := newClient(t, s).Alias(tt.index, tt.alias)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Alias() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Alias() = %v, want %v", got, tt.want)
+			}
+			if ia := aliases(s); !reflect.DeepEqual(ia, tt.after) {
+				t.Errorf("aliases = %v, want %v", ia, tt.after)
+			}
+		})
+	}
+}
+
+func TestDefault(t *testing.T) {
+	d := elasticbook.DefaultAliasName
+	tests := []struct {
+		name    string
+		indices map[string][]string
+		index   string
+		wantErr error
+		after   map[string][]string
+	}{
+		{
+			name:    "first default",
+			indices: map[string][]string{"a": nil},
+			index:   "a",
+			after:   map[string][]string{"a": {d}},
+		},
+		{
+			name:    "switch",
+			indices: map[string][]string{"a": {d, "foo"}, "b": nil},
+			index:   "b",
+			after:   map[string][]string{"a": {"foo"}, "b": {d}},
+		},
+		{
+			name:    "held by several indices",
+			indices: map[string][]string{"a": {d}, "b": {d}, "c": nil},
+			index:   "c",
+			after:   map[string][]string{"a": nil, "b": nil, "c": {d}},
+		},
+		{
+			name:    "already the default",
+			indices: map[string][]string{"a": {d}},
+			index:   "a",
+			after:   map[string][]string{"a": {d}},
+		},
+		{
+			name:    "missing index",
+			indices: map[string][]string{"a": {d}},
+			index:   "b",
+			wantErr: elasticbook.ErrIndexNotFound,
+			after:   map[string][]string{"a": {d}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := estest.NewServer()
+			defer s.Close()
+			setup(s, tt.indices)
+
+			got, err := newClient(t, s).Default(tt.index)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Default() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != (tt.wantErr == nil) {
+				t.Errorf("Default() = %v, want %v", got, tt.wantErr == nil)
+			}
+			if ia := aliases(s); !reflect.DeepEqual(ia, tt.after) {
+				t.Errorf("aliases = %v, want %v", ia, tt.after)
+			}
+		})
+	}
+}
+
+func TestUnalias(t *testing.T) {
+	tests := []struct {
+		name    string
+		indices map[string][]string
+		alias   string
+		after   map[string][]string
+	}{
+		{
+			name:    "one index",
+			indices: map[string][]string{"a": {"foo", "bar"}},
+			alias:   "foo",
+			after:   map[string][]string{"a": {"bar"}},
+		},
+		{
+			name:    "several indices",
+			indices: map[string][]string{"a": {"foo"}, "b": {"foo"}},
+			alias:   "foo",
+			after:   map[string][]string{"a": nil, "b": nil},
+		},
+		{
+			name:    "unknown alias",
+			indices: map[string][]string{"a": {"bar"}},
+			alias:   "foo",
+			after:   map[string][]string{"a": {"bar"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := estest.NewServer()
+			defer s.Close()
+			setup(s, tt.indices)
+
+			got, err := newClient(t, s).Unalias(tt.alias)
+			if err != nil {
+				t.Fatalf("Unalias() error = %v", err)
+			}
+			if !got {
+				t.Errorf("Unalias() = %v, want true", got)
+			}
+			if ia := aliases(s); !reflect.DeepEqual(ia, tt.after) {
+				t.Errorf("aliases = %v, want %v", ia, tt.after)
+			}
+		})
+	}
+}
+
+func TestIndex(t *testing.T) {
+	tests := []struct {
+		name        string
+		sources     []*elasticbook.Source
+		reject      string
+		maxFailures int
+		wantErr     error
+		succeeded   []string
+		failed      []string
+		kept        bool
+	}{
+		{
+			name:      "Bookmarks file",
+			sources:   []*elasticbook.Source{elasticbook.NewSource("", "", newRoot())},
+			succeeded: []string{"4", "6", "7"},
+			kept:      true,
+		},
+		{
+			name: "browser profiles",
+			sources: []*elasticbook.Source{
+				elasticbook.NewSource("chrome", "Default", newRoot()),
+				elasticbook.NewSource("chrome", "Profile 1", newRoot()),
+			},
+			succeeded: []string{
+				"chrome/Default:4", "chrome/Default:6", "chrome/Default:7",
+				"chrome/Profile 1:4", "chrome/Profile 1:6", "chrome/Profile 1:7",
+			},
+			kept: true,
+		},
+		{
+			name:        "failures tolerated",
+			sources:     []*elasticbook.Source{elasticbook.NewSource("", "", newRoot())},
+			reject:      "6",
+			maxFailures: -1,
+			succeeded:   []string{"4", "7"},
+			failed:      []string{"6"},
+			kept:        true,
+		},
+		{
+			name:        "unparseable date",
+			sources:     []*elasticbook.Source{elasticbook.NewSource("", "", badDate())},
+			maxFailures: -1,
+			succeeded:   []string{"4", "7"},
+			failed:      []string{"6"},
+			kept:        true,
+		},
+		{
+			name:        "aborted",
+			sources:     []*elasticbook.Source{elasticbook.NewSource("", "", newRoot())},
+			reject:      "6",
+			maxFailures: 0,
+			wantErr:     elasticbook.ErrIndexAborted,
+			succeeded:   []string{"4", "7"},
+			failed:      []string{"6"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := estest.NewServer()
+			defer s.Close()
+			if tt.reject != "" {
+				s.Reject(tt.reject, "rejected by the test")
+			}
+
+			c := newClient(t, s, elasticbook.SetMaxFailures(tt.maxFailures))
+			rep, err := c.Index(tt.sources...)
+			if err != tt.wantErr {
+				t.Fatalf("Index() error = %v, want %v", err, tt.wantErr)
+			}
+
+			succeeded := append([]string(nil), rep.Succeeded...)
+			sort.Strings(succeeded)
+			if !reflect.DeepEqual(succeeded, tt.succeeded) {
+				t.Errorf("Succeeded = %v, want %v", succeeded, tt.succeeded)
+			}
+			var failed []string
+			for _, f := range rep.Failed {
+				failed = append(failed, f.ID)
+			}
+			if !reflect.DeepEqual(failed, tt.failed) {
+				t.Errorf("Failed = %v, want %v", failed, tt.failed)
+			}
+
+			ins := s.IndexNames()
+			if !tt.kept {
+				if len(ins) != 0 {
+					t.Errorf("indices = %v, want the aborted one deleted", ins)
+				}
+				return
+			}
+			if !reflect.DeepEqual(ins, []string{rep.IndexName}) {
+				t.Fatalf("indices = %v, want [%s]", ins, rep.IndexName)
+			}
+			var ids []string
+			for id := range s.Docs(rep.IndexName) {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			if !reflect.DeepEqual(ids, tt.succeeded) {
+				t.Errorf("documents = %v, want %v", ids, tt.succeeded)
+			}
+			meta, _ := s.Mapping(rep.IndexName, elasticbook.TypeName)["_meta"].(map[string]interface{})
+			if meta["checksum"] == nil || meta["checksum"] == "" {
+				t.Errorf("_meta = %v, want the checksum", meta)
+			}
+		})
+	}
+}
+
+func TestIndexCanceled(t *testing.T) {
+	s := estest.NewServer()
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c := newClient(t, s)
+	_, err := c.IndexContext(ctx, elasticbook.NewSource("", "", newRoot()))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("IndexContext() error = %v, want %v", err, context.Canceled)
+	}
+	if ins := s.IndexNames(); len(ins) != 0 {
+		t.Errorf("indices = %v, want none", ins)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	s := estest.NewServer()
+	defer s.Close()
+
+	c := newClient(t, s)
+	rep, err := c.Index(
+		elasticbook.NewSource("chrome", "Default", newRoot()),
+		elasticbook.NewSource("chromium", "Default", newRoot()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Default(rep.IndexName); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		term    string
+		options elasticbook.SearchOptions
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "everywhere",
+			term: "go",
+			want: []string{"chrome/Default:4", "chrome/Default:6", "chromium/Default:4", "chromium/Default:6"},
+		},
+		{
+			name:    "folder subtree",
+			term:    "go",
+			options: elasticbook.SearchOptions{Folder: "Bookmarks Bar/Work"},
+			want:    []string{"chrome/Default:6", "chromium/Default:6"},
+		},
+		{
+			name:    "root folder",
+			term:    "elasticsearch",
+			options: elasticbook.SearchOptions{Folder: "Bookmarks Bar"},
+			want:    nil,
+		},
+		{
+			name:    "browser",
+			term:    "go",
+			options: elasticbook.SearchOptions{Browser: "chromium"},
+			want:    []string{"chromium/Default:4", "chromium/Default:6"},
+		},
+		{
+			name:    "browser and profile",
+			term:    "elastic",
+			options: elasticbook.SearchOptions{Browser: "chrome", Profile: "Default"},
+			want:    []string{"chrome/Default:7"},
+		},
+		{
+			name:    "added after",
+			term:    "go",
+			options: elasticbook.SearchOptions{Browser: "chrome", After: time.Date(2015, 12, 1, 0, 0, 0, 0, time.UTC)},
+			want:    []string{"chrome/Default:4", "chrome/Default:6"},
+		},
+		{
+			name:    "added before",
+			term:    "go",
+			options: elasticbook.SearchOptions{Before: time.Date(2015, 12, 1, 0, 0, 0, 0, time.UTC)},
+			want:    nil,
+		},
+		{
+			name: "added between",
+			term: "elastic",
+			options: elasticbook.SearchOptions{
+				After:  time.Date(2015, 12, 13, 0, 0, 0, 0, time.UTC),
+				Before: time.Date(2015, 12, 14, 0, 0, 0, 0, time.UTC)},
+			want: []string{"chrome/Default:7", "chromium/Default:7"},
+		},
+		{
+			name: "nothing",
+			term: "rust",
+			want: nil,
+		},
+		{
+			name:    "excluded word",
+			term:    "go -example",
+			options: elasticbook.SearchOptions{Browser: "chrome"},
+			want:    []string{"chrome/Default:4"},
+		},
+		{
+			name: "phrase",
+			term: `"go by example"`,
+			want: []string{"chrome/Default:6", "chromium/Default:6"},
+		},
+		{
+			name: "site only",
+			term: "site:elastic.co",
+			want: []string{"chrome/Default:7", "chromium/Default:7"},
+		},
+		{
+			name:    "operators override the options",
+			term:    "go folder:Work source:chromium/Default",
+			options: elasticbook.SearchOptions{Browser: "chrome"},
+			want:    []string{"chromium/Default:6"},
+		},
+		{
+			name: "phrase with a slop",
+			term: `"go example"~1`,
+			want: []string{"chrome/Default:6", "chromium/Default:6"},
+		},
+		{
+			name: "phrase without enough slop",
+			term: `"go example"`,
+			want: nil,
+		},
+		{
+			name:    "default slop",
+			term:    `"go example"`,
+			options: elasticbook.SearchOptions{Slop: 2},
+			want:    []string{"chrome/Default:6", "chromium/Default:6"},
+		},
+		{
+			name:    "malformed query",
+			term:    `go "by example`,
+			wantErr: elasticbook.ErrQuerySyntax,
+		},
+		{
+			name:    "bad cursor",
+			term:    "go",
+			options: elasticbook.SearchOptions{Cursor: "garbage"},
+			wantErr: elasticbook.ErrBadCursor,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr, err := c.SearchWith(tt.term, tt.options)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SearchWith() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var ids []string
+			for _, h := range sr.Hits {
+				ids = append(ids, h.ID)
+			}
+			sort.Strings(ids)
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("SearchWith() = %v, want %v", ids, tt.want)
+			}
+			if sr.TotalHits != int64(len(tt.want)) {
+				t.Errorf("TotalHits = %d, want %d", sr.TotalHits, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	s := estest.NewServer()
+	defer s.Close()
+
+	c := newClient(t, s)
+	rep, err := c.Index(
+		elasticbook.NewSource("chrome", "Default", newRoot()),
+		elasticbook.NewSource("chromium", "Default", newRoot()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Default(rep.IndexName); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	o := elasticbook.SearchOptions{Size: 3}
+	for page := 1; ; page++ {
+		sr, err := c.SearchWith("go", o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sr.Page != page || sr.TotalHits != 4 {
+			t.Fatalf("Page = %d, TotalHits = %d, want %d, 4", sr.Page, sr.TotalHits, page)
+		}
+		if (page > 1) != (sr.Prev != "") {
+			t.Errorf("page %d: Prev = %q", page, sr.Prev)
+		}
+		for _, h := range sr.Hits {
+			ids = append(ids, h.ID)
+		}
+		if sr.Next == "" {
+			break
+		}
+		o.Cursor = sr.Next
+	}
+	sort.Strings(ids)
+	want := []string{"chrome/Default:4", "chrome/Default:6", "chromium/Default:4", "chromium/Default:6"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("pages = %v, want %v", ids, want)
+	}
+
+	if _, err := c.SearchWith("elastic", o); !errors.Is(err, elasticbook.ErrBadCursor) {
+		t.Errorf("cursor of another search: error = %v, want %v", err, elasticbook.ErrBadCursor)
+	}
+}
+
+func TestSearchSort(t *testing.T) {
+	s := estest.NewServer()
+	defer s.Close()
+
+	// "The Go Programming Language" is the last one added
+	r := newRoot()
+	r.Roots.BookmarkBar.Children[0].DateAdded = "13094560000000000"
+	c := newClient(t, s)
+	rep, err := c.Index(elasticbook.NewSource("chrome", "Default", r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Default(rep.IndexName); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sort    elasticbook.Sort
+		want    []string
+		wantErr error
+	}{
+		{sort: elasticbook.SortNewest, want: []string{"chrome/Default:4", "chrome/Default:6", "chrome/Default:7"}},
+		{sort: elasticbook.SortOldest, want: []string{"chrome/Default:6", "chrome/Default:7", "chrome/Default:4"}},
+		{sort: elasticbook.SortTitle, want: []string{"chrome/Default:7", "chrome/Default:6", "chrome/Default:4"}},
+		{sort: elasticbook.SortDomain, want: []string{"chrome/Default:7", "chrome/Default:6", "chrome/Default:4"}},
+		{sort: "shuffle", wantErr: elasticbook.ErrUnknownSort},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.sort), func(t *testing.T) {
+			sr, err := c.SearchWith("after:2000", elasticbook.SearchOptions{Sort: tt.sort})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SearchWith() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var ids []string
+			for _, h := range sr.Hits {
+				ids = append(ids, h.ID)
+				if h.Score == 0 {
+					t.Errorf("%s: no score", h.ID)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("SearchWith() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	sr, err := c.SearchWith("after:2000", elasticbook.SearchOptions{Size: 1, Sort: elasticbook.SortTitle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := elasticbook.SearchOptions{Sort: elasticbook.SortNewest, Cursor: sr.Next}
+	if _, err := c.SearchWith("after:2000", o); !errors.Is(err, elasticbook.ErrBadCursor) {
+		t.Errorf("cursor of another sort: error = %v, want %v", err, elasticbook.ErrBadCursor)
+	}
+}
+
+func TestSync(t *testing.T) {
+	s := estest.NewServer()
+	defer s.Close()
+
+	c := newClient(t, s)
+	rep, err := c.Index(elasticbook.NewSource("", "", newRoot()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Default(rep.IndexName); err != nil {
+		t.Fatal(err)
+	}
+
+	// "Go by Example" renamed, "Elasticsearch" removed, a bookmark added;
+	// the cluster refuses the new one
+	r := newRoot()
+	r.Checksum = "1f1f1f"
+	r.Roots.BookmarkBar.Children[1].Children[0].Name = "Go By Example"
+	r.Roots.Other.Children = []elasticbook.Bookmark{
+		{OriginalID: "8", Name: "Rust", URL: "https://www.rust-lang.org/", Type: elasticbook.URLNodeType, DateAdded: dateAdded},
+	}
+	s.Reject("8", "rejected by the test")
+
+	srep, err := c.Sync(elasticbook.NewSource("", "", r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srep.Added) != 0 {
+		t.Errorf("Added = %v, want none (refused)", srep.Added)
+	}
+	if !reflect.DeepEqual(srep.Updated, []string{"6"}) {
+		t.Errorf("Updated = %v, want [6]", srep.Updated)
+	}
+	if !reflect.DeepEqual(srep.Deleted, []string{"7"}) {
+		t.Errorf("Deleted = %v, want [7]", srep.Deleted)
+	}
+	if srep.Unchanged != 1 {
+		t.Errorf("Unchanged = %d, want 1", srep.Unchanged)
+	}
+	if len(srep.Failed) != 1 || srep.Failed[0].ID != "8" {
+		t.Errorf("Failed = %v, want [8]", srep.Failed)
+	}
+}
+
+func TestSearchFolderSeparator(t *testing.T) {
+	s := estest.NewServer()
+	defer s.Close()
+
+	// a "CI/CD" folder, and a "CD" folder inside a "CI" one
+	r := newRoot()
+	r.Roots.BookmarkBar.Children = []elasticbook.Bookmark{
+		{OriginalID: "10", Name: "CI/CD", Type: elasticbook.FolderNodeType, DateAdded: dateAdded, Children: []elasticbook.Bookmark{
+			{OriginalID: "11", Name: "Jenkins", URL: "https://jenkins.io/", Type: elasticbook.URLNodeType, DateAdded: dateAdded},
+		}},
+		{OriginalID: "12", Name: "CI", Type: elasticbook.FolderNodeType, DateAdded: dateAdded, Children: []elasticbook.Bookmark{
+			{OriginalID: "13", Name: "CD", Type: elasticbook.FolderNodeType, DateAdded: dateAdded, Children: []elasticbook.Bookmark{
+				{OriginalID: "14", Name: "Spinnaker", URL: "https://www.spinnaker.io/", Type: elasticbook.URLNodeType, DateAdded: dateAdded},
+			}},
+		}},
+	}
+	c := newClient(t, s)
+	rep, err := c.Index(elasticbook.NewSource("", "", r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Default(rep.IndexName); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		folder string
+		want   []string
+	}{
+		{folder: "Bookmarks Bar/CI", want: []string{"14"}},
+		{folder: "Bookmarks Bar/CI/CD", want: []string{"14"}},
+		{folder: "Bookmarks Bar/CI%2FCD", want: []string{"11"}},
+		{folder: "Bookmarks Bar", want: []string{"11", "14"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.folder, func(t *testing.T) {
+			sr, err := c.SearchWith("io", elasticbook.SearchOptions{Folder: tt.folder})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, h := range sr.Hits {
+				ids = append(ids, h.ID)
+			}
+			sort.Strings(ids)
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("SearchWith() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetContextUnreachable(t *testing.T) {
+	s := estest.NewServer()
+	u := s.URL
+	s.Close()
+
+	_, err := elasticbook.NewClient(elasticbook.SetContext(&elasticbook.Context{URL: u}))
+	if !errors.Is(err, elasticbook.ErrClusterUnreachable) {
+		t.Errorf("NewClient() error = %v, want %v", err, elasticbook.ErrClusterUnreachable)
+	}
+}
+
+func TestSyncDefaultIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		indices map[string][]string
+		wantErr error
+	}{
+		{
+			name:    "no default",
+			indices: map[string][]string{"elasticbook-20160101000000": nil},
+			wantErr: elasticbook.ErrIndexNotFound,
+		},
+		{
+			name: "default on two indices",
+			indices: map[string][]string{
+				"elasticbook-20160101000000": {elasticbook.DefaultAliasName},
+				"elasticbook-20160102000000": {elasticbook.DefaultAliasName},
+			},
+			wantErr: elasticbook.ErrAliasConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := estest.NewServer()
+			defer s.Close()
+			setup(s, tt.indices)
+
+			c := newClient(t, s)
+			_, err := c.Sync(elasticbook.NewSource("", "", newRoot()))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Sync() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,24 +1,70 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"math/rand"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/boltdb/bolt"
 	"github.com/codegangsta/cli"
 	"github.com/fatih/color"
 	"github.com/zeroed/elasticbook"
+	"github.com/zeroed/elasticbook/embedded"
+	"github.com/zeroed/elasticbook/firefox"
+	"github.com/zeroed/elasticbook/netscape"
 	"github.com/zeroed/elasticbook/utils"
 	"github.com/zeroed/elasticbook/web"
 )
 
+// BackendEnv is the environment variable picking the backend
+const BackendEnv = "ELASTICBOOK_BACKEND"
+
+// The backend to use (see backend)
+var backendName string
+
+// contextName is the cluster context picked with the context flag
+var contextName string
+
+// timeout bounds the requests to the cluster (see clientContext)
+var timeout time.Duration
+
+// ctx is canceled on Ctrl-C: the running command stops (e.g. an index
+// run discards its partial index)
+var ctx = context.Background()
+
+// stop restores the default Ctrl-C behaviour (see main)
+var stop context.CancelFunc = func() {}
+
+// The Bookmarks files to work on (see bookmarksFilePath and sources)
+var (
+	allProfiles bool
+	browser     string
+	profile     string
+	bookmarks   string
+	htmlFile    string
+	places      string
+)
+
+// The tuning of the index, reindex and sync commands (see bulkFlags)
+var (
+	bulkActions int
+	bulkFlush   time.Duration
+	bulkWorkers int
+	maxFailures int
+	keepAborted bool
+)
+
+// verbose shows the score explanation of the search hits
+var verbose bool
+
 func main() {
 	rand.Seed(time.Now().UnixNano())
 	app := cli.NewApp()
@@ -26,25 +72,59 @@ func main() {
 	app.Usage = "Elasticsearch for your bookmarks"
 	app.Version = "0.0.1"
 
-	var command string
-	var term string
-	var sweb bool
-	var verbose bool
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
-			Name:        "command, c",
-			Usage:       "-c [alias|aliases|unalias|default|indices|index|mappings|count|health|parse|delete]",
-			Destination: &command,
+			Name:        "backend",
+			Value:       "elasticsearch",
+			Usage:       "--backend [elasticsearch|embedded] (embedded: no cluster, data in $" + embedded.DataDirEnv + " or ~/.elasticbook)",
+			EnvVar:      BackendEnv,
+			Destination: &backendName,
+		},
+		cli.StringFlag{
+			Name:        "context",
+			Usage:       "--context [name] (cluster context of " + elasticbook.DefaultConfigFile() + ")",
+			EnvVar:      elasticbook.ContextEnv,
+			Destination: &contextName,
+		},
+		cli.DurationFlag{
+			Name:        "timeout",
+			Usage:       "--timeout [30s] (requests to the cluster, default: the context one or " + elasticbook.DefaultTimeout.String() + ")",
+			Destination: &timeout,
+		},
+		cli.StringFlag{
+			Name:        "browser, b",
+			Usage:       "-b [chrome|chromium|brave|edge|vivaldi|firefox] (default: any)",
+			EnvVar:      utils.BrowserEnv,
+			Destination: &browser,
+		},
+		cli.StringFlag{
+			Name:        "profile, p",
+			Usage:       "-p [Default|Profile 1,Profile 2|...] (browser profiles)",
+			EnvVar:      utils.ProfileEnv,
+			Destination: &profile,
 		},
 		cli.BoolFlag{
-			Name:        "web, w",
-			Usage:       "Starts the web interface",
-			Destination: &sweb,
+			Name:        "all-profiles",
+			Usage:       "index the bookmarks of all the browser profiles found",
+			Destination: &allProfiles,
 		},
 		cli.StringFlag{
-			Name:        "search, s",
-			Usage:       "-s [term]",
-			Destination: &term,
+			Name:        "bookmarks",
+			Usage:       "--bookmarks [path] (explicit Bookmarks file)",
+			EnvVar:      utils.BookmarksFileEnv,
+			Destination: &bookmarks,
+		},
+		cli.StringFlag{
+			Name:        "firefox",
+			Usage:       "--firefox [path] (explicit Firefox places.sqlite file)",
+			EnvVar:      firefox.PlacesFileEnv,
+			Destination: &places,
+		},
+		cli.StringFlag{
+			Name:        "html",
+			Usage:       "--html [path] (explicit Netscape bookmarks.html file)",
+			EnvVar:      netscape.HTMLFileEnv,
+			Destination: &htmlFile,
 		},
 		cli.BoolFlag{
 			Name:        "verbose, V",
@@ -53,127 +133,537 @@ func main() {
 		},
 	}
 
-	app.Action = func(cc *cli.Context) {
-		if sweb {
-			_, filename, _, _ := runtime.Caller(0)
-			templateDir := filepath.Join(filename, "..", "..", "..", "web", "templates")
-			publicDir := filepath.Join(filename, "..", "..", "..", "web", "public")
-			wapp, err := web.NewApp(
-				web.SetVerbose(false),
-				web.SetPublicDir(publicDir),
-				web.SetTemplateDir(templateDir))
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Unable to start WebInterface: %s\n", err)
-				os.Exit(1)
-			}
-			wapp.Start()
-			os.Exit(0)
-		}
-
-		if command != "" && term != "" {
-			fmt.Fprintf(os.Stderr, "You cannot set a command AND make a search\n\n")
-			os.Exit(1)
-		}
-
-		if command == "" && term == "" {
-			fmt.Fprintf(os.Stdout, "You shuld set a command OR make a search\n\n")
-			cli.ShowAppHelp(cc)
-			os.Exit(1)
-		}
-
-		if command == "alias" {
-			alias()
-		} else if command == "aliases" {
-			aliases()
-		} else if command == "unalias" {
-			unalias()
-		} else if command == "count" {
-			count()
-		} else if command == "default" {
-			defaultAlias()
-		} else if command == "delete" {
-			deleteIndex()
-		} else if command == "health" {
-			health()
-		} else if command == "indices" {
-			indices()
-		} else if command == "index" {
-			index()
-		} else if command == "mappings" {
-			mappings()
-		} else if command == "parse" {
-			parse()
-		} else if command == "version" {
-			version()
-		} else {
-			if term == "" {
-				fmt.Fprintf(os.Stderr, "Command not supported\n\n")
+	var dryRun bool
+	var fix bool
+	var after string
+	var before string
+	var folder string
+	var format string
+	var indexName string
+	var aliasName string
+	var output string
+	var source string
+	var slop int
+	var sortBy string
+	var page int
+	var limit int
+	var cursor string
+	var keep int
+	var maxAge time.Duration
+	var yes bool
 
-				cli.ShowAppHelp(cc)
-			}
+	searchFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:        "folder, f",
+			Usage:       "-f [Bookmarks Bar/Work] (search in a folder subtree)",
+			Destination: &folder,
+		},
+		cli.StringFlag{
+			Name:        "source",
+			Usage:       "--source [chrome/Profile 1] (search in a browser profile)",
+			Destination: &source,
+		},
+		cli.StringFlag{
+			Name:        "after",
+			Usage:       "--after [2016-01-02|yesterday|last 3 months|2 weeks ago] (added since)",
+			Destination: &after,
+		},
+		cli.StringFlag{
+			Name:        "before",
+			Usage:       "--before [2016-01-02|last year|...] (added before)",
+			Destination: &before,
+		},
+		cli.IntFlag{
+			Name:        "slop",
+			Usage:       "--slop [N] (words allowed between the ones of a quoted phrase, unless \"...\"~N)",
+			Destination: &slop,
+		},
+		cli.StringFlag{
+			Name:        "sort",
+			Usage:       "--sort [" + sortNames() + "] (order of the results, the scores are kept)",
+			Destination: &sortBy,
+		},
+	}
+	searchOptions := func() (elasticbook.SearchOptions, error) {
+		o := elasticbook.SearchOptions{Folder: folder, Slop: slop}
+		o.Browser, o.Profile = elasticbook.ParseSource(source)
+		var err error
+		if o.After, err = parseDate(after); err != nil {
+			return o, err
 		}
-
-		if term != "" {
-			searchTerm(term, verbose)
+		if o.Before, err = parseDate(before); err != nil {
+			return o, err
 		}
+		o.Sort, err = parseSort(sortBy)
+		return o, err
 	}
 
-	app.Run(os.Args)
-}
+	app.Commands = []cli.Command{
+		{
+			Name:      "search",
+			Aliases:   []string{"s"},
+			Usage:     "look for bookmarks",
+			ArgsUsage: "QUERY (e.g. golang site:github.com folder:Work after:2015-06 -tutorial \"exact phrase\")",
+			Flags: append([]cli.Flag{
+				cli.IntFlag{
+					Name:        "page",
+					Value:       1,
+					Usage:       "--page [N] (counted from 1)",
+					Destination: &page,
+				},
+				cli.IntFlag{
+					Name:        "limit",
+					Value:       elasticbook.DefaultPageSize,
+					Usage:       "--limit [N] (hits per page, at most " + strconv.Itoa(elasticbook.MaxPageSize) + ")",
+					Destination: &limit,
+				},
+				cli.StringFlag{
+					Name:        "cursor",
+					Usage:       "--cursor [token] (the page printed by the previous search, same QUERY and flags)",
+					Destination: &cursor,
+				},
+			}, searchFlags...),
+			Action: func(cc *cli.Context) error {
+				term := strings.Join(cc.Args(), " ")
+				if term == "" {
+					return usagef("Missing QUERY")
+				}
+				o, err := searchOptions()
+				if err != nil {
+					return err
+				}
+				o.Page, o.Size, o.Cursor = page, limit, cursor
+				return searchTerm(term, o, verbose)
+			},
+		},
+		{
+			Name:    "web",
+			Aliases: []string{"w"},
+			Usage:   "start the web interface",
+			Action: func(cc *cli.Context) error {
+				return startWeb()
+			},
+		},
+		{
+			Name:  "index",
+			Usage: "manage the indices",
+			Subcommands: []cli.Command{
+				{
+					Name:  "create",
+					Usage: "build a new index from the bookmarks",
+					Flags: bulkFlags(),
+					Action: func(cc *cli.Context) error {
+						return index(false, bulkOptions()...)
+					},
+				},
+				{
+					Name:    "list",
+					Aliases: []string{"ls"},
+					Usage:   "list the indices, with their document count",
+					Action: func(cc *cli.Context) error {
+						b, err := backend()
+						if err != nil {
+							return err
+						}
+						defer closeBackend(b)
+						return indices(b)
+					},
+				},
+				{
+					Name:      "delete",
+					Aliases:   []string{"rm"},
+					Usage:     "drop an index",
+					ArgsUsage: "[INDEX]",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:        "yes, y",
+							Usage:       "do not ask for a confirmation",
+							Destination: &yes,
+						},
+					},
+					Action: func(cc *cli.Context) error {
+						return deleteIndex(cc.Args().First(), yes)
+					},
+				},
+			},
+		},
+		{
+			Name:  "reindex",
+			Usage: "build a new index and move the default alias to it",
+			Flags: bulkFlags(),
+			Action: func(cc *cli.Context) error {
+				return index(true, bulkOptions()...)
+			},
+		},
+		{
+			Name:  "sync",
+			Usage: "bring the default index in line with the bookmarks",
+			Flags: bulkFlags()[:3],
+			Action: func(cc *cli.Context) error {
+				return syncIndex(bulkOptions()[:3]...)
+			},
+		},
+		{
+			Name:  "prune",
+			Usage: "delete the old indices",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:        "keep",
+					Usage:       "keep the N most recent indices",
+					Destination: &keep,
+				},
+				cli.DurationFlag{
+					Name:        "max-age",
+					Usage:       "keep the indices younger than this, e.g. 720h",
+					Destination: &maxAge,
+				},
+				cli.BoolFlag{
+					Name:        "dry-run",
+					Usage:       "show what would be deleted",
+					Destination: &dryRun,
+				},
+			},
+			Action: func(cc *cli.Context) error {
+				return prune(elasticbook.PruneOptions{
+					Keep:   keep,
+					MaxAge: maxAge,
+					DryRun: dryRun,
+				})
+			},
+		},
+		{
+			Name:  "doctor",
+			Usage: "look for broken states of the cluster",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:        "fix",
+					Usage:       "apply the repairs found",
+					Destination: &fix,
+				},
+			},
+			Action: func(cc *cli.Context) error {
+				return doctor(fix)
+			},
+		},
+		{
+			Name:      "export",
+			Usage:     "write an index, or the results of a search",
+			ArgsUsage: "[QUERY]",
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:        "format",
+					Value:       "json",
+					Usage:       "--format [html|json|csv|chrome]",
+					Destination: &format,
+				},
+				cli.StringFlag{
+					Name:        "output, o",
+					Usage:       "-o [path] (default: stdout)",
+					Destination: &output,
+				},
+				cli.StringFlag{
+					Name:        "index",
+					Usage:       "--index [name] (default: the default alias)",
+					Destination: &indexName,
+				},
+			}, searchFlags...),
+			Action: func(cc *cli.Context) error {
+				o, err := searchOptions()
+				if err != nil {
+					return err
+				}
+				return export(indexName, format, output, strings.Join(cc.Args(), " "), o)
+			},
+		},
+		{
+			Name:  "alias",
+			Usage: "manage the aliases",
+			Subcommands: []cli.Command{
+				{
+					Name:  "add",
+					Usage: "add an alias to an index",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:        "index",
+							Usage:       "--index [name] (asked if missing)",
+							Destination: &indexName,
+						},
+						cli.StringFlag{
+							Name:        "name",
+							Usage:       "--name [alias] (asked if missing)",
+							Destination: &aliasName,
+						},
+					},
+					Action: func(cc *cli.Context) error {
+						return alias(indexName, aliasName)
+					},
+				},
+				{
+					Name:    "list",
+					Aliases: []string{"ls"},
+					Usage:   "list the indices, with their aliases",
+					Action: func(cc *cli.Context) error {
+						b, err := backend()
+						if err != nil {
+							return err
+						}
+						defer closeBackend(b)
+						return aliases(b)
+					},
+				},
+				{
+					Name:      "remove",
+					Aliases:   []string{"rm"},
+					Usage:     "remove an alias",
+					ArgsUsage: "[ALIAS]",
+					Action: func(cc *cli.Context) error {
+						return unalias(cc.Args().First())
+					},
+				},
+			},
+		},
+		{
+			Name:  "default",
+			Usage: "manage the default alias",
+			Subcommands: []cli.Command{
+				{
+					Name:      "set",
+					Usage:     "point the default alias to an index",
+					ArgsUsage: "[INDEX]",
+					Action: func(cc *cli.Context) error {
+						return defaultAlias(cc.Args().First())
+					},
+				},
+			},
+		},
+		{
+			Name:  "count",
+			Usage: "count the bookmarks of the Bookmarks file",
+			Action: func(cc *cli.Context) error {
+				return count()
+			},
+		},
+		{
+			Name:  "parse",
+			Usage: "check the Bookmarks file",
+			Action: func(cc *cli.Context) error {
+				return parse()
+			},
+		},
+		{
+			Name:  "profiles",
+			Usage: "list the browser profiles found",
+			Action: func(cc *cli.Context) error {
+				return profiles()
+			},
+		},
+		{
+			Name:  "health",
+			Usage: "show the cluster health",
+			Action: func(cc *cli.Context) error {
+				return health()
+			},
+		},
+		{
+			Name:  "mappings",
+			Usage: "show the mappings of the indices",
+			Action: func(cc *cli.Context) error {
+				return mappings()
+			},
+		},
+		{
+			Name:  "version",
+			Usage: "show the Elasticsearch version",
+			Action: func(cc *cli.Context) error {
+				return version()
+			},
+		},
+	}
 
-func alias() {
-	c, _ := aliases()
+	ctx, stop = signal.NotifyContext(context.Background(), os.Interrupt)
 
-	ics, err := c.IndexNames()
-	if len(ics) == 0 {
-		fmt.Fprintf(os.Stderr, "There are no indexes\n")
+	// The commands return their errors instead of exiting, so that their
+	// defers (e.g. closing the embedded indices) run: cli prints the
+	// message and exits with the status of an ExitError.
+	err := app.Run(os.Args)
+	stop()
+	if err != nil {
 		os.Exit(1)
 	}
+}
 
-	fmt.Fprintf(os.Stdout, "Index ")
-	i := askForIndex(len(ics) - 1)
-	indexName := ics[i]
-	var aliasName string
+// fail turns an error into a failure of the command (exit status 1)
+func fail(err error) error {
+	return cli.NewExitError(err.Error(), 1)
+}
+
+// failf is fail with a formatted message
+func failf(format string, a ...interface{}) error {
+	return cli.NewExitError(fmt.Sprintf(format, a...), 1)
+}
+
+// usagef reports a missing or bad argument (exit status 2)
+func usagef(format string, a ...interface{}) error {
+	return cli.NewExitError(fmt.Sprintf(format, a...), 2)
+}
 
-	fmt.Fprintf(os.Stdout, "Alias name: ")
-	_, err = fmt.Scanln(&aliasName)
-	if err != nil && err.Error() == "unexpected newline" {
-		alias()
+// errNoAnswer ends a command when the input ends before an answer
+var errNoAnswer = cli.NewExitError("", 1)
+
+// bulkFlags are the flags of the commands sending the bookmarks: the
+// first three are the bulk ones (see bulkOptions)
+func bulkFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.IntFlag{
+			Name:        "bulk-actions",
+			Value:       elasticbook.DefaultBulkActions,
+			Usage:       "bookmarks sent in a single bulk request",
+			Destination: &bulkActions,
+		},
+		cli.DurationFlag{
+			Name:        "bulk-flush",
+			Value:       elasticbook.DefaultBulkFlushInterval,
+			Usage:       "flush interval of the pending bulk requests (Elasticsearch only)",
+			Destination: &bulkFlush,
+		},
+		cli.IntFlag{
+			Name:        "bulk-workers",
+			Value:       elasticbook.DefaultBulkWorkers,
+			Usage:       "concurrent bulk requests (Elasticsearch only)",
+			Destination: &bulkWorkers,
+		},
+		cli.IntFlag{
+			Name:        "max-failures",
+			Value:       elasticbook.DefaultMaxFailures,
+			Usage:       "failed bookmarks tolerated before aborting (-1: never abort)",
+			Destination: &maxFailures,
+		},
+		cli.BoolFlag{
+			Name:        "keep-aborted",
+			Usage:       "keep an aborted index (marked with an alias) instead of deleting it",
+			Destination: &keepAborted,
+		},
 	}
+}
 
-	if aliasName == elasticbook.DefaultAliasName {
-		fmt.Fprintf(
-			os.Stderr,
-			"%s is the default alias name. Use `-c default` to assign the default index\n",
-			aliasName)
-		alias()
+// bulkOptions are the Client options set by the bulkFlags, in the same
+// order
+func bulkOptions() []elasticbook.ClientOptionFunc {
+	return []elasticbook.ClientOptionFunc{
+		elasticbook.SetBulkActions(bulkActions),
+		elasticbook.SetBulkFlushInterval(bulkFlush),
+		elasticbook.SetBulkWorkers(bulkWorkers),
+		elasticbook.SetMaxFailures(maxFailures),
+		elasticbook.SetKeepAborted(keepAborted),
 	}
+}
 
-	ack, err := c.Alias(indexName, aliasName)
+// parseDate parses a date flag (see elasticbook.ParseDate). The empty
+// string is the zero Time (no bound).
+func parseDate(expr string) (time.Time, error) {
+	if expr == "" {
+		return time.Time{}, nil
+	}
+	t, err := elasticbook.ParseDate(expr, time.Now())
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return t, usagef("%s", err.Error())
 	}
+	return t, nil
+}
 
-	if ack {
-		aliases()
-	} else {
-		fmt.Fprintf(os.Stderr, "Cannot create your alias. Maybe is already there...\n")
-		os.Exit(1)
+// parseSort parses the --sort flag
+func parseSort(s string) (elasticbook.Sort, error) {
+	x, err := elasticbook.ParseSort(s)
+	if err != nil {
+		return x, usagef("%s (one of %s)", err.Error(), sortNames())
+	}
+	return x, nil
+}
+
+// sortNames lists the orders of the search results
+func sortNames() string {
+	ns := make([]string, len(elasticbook.Sorts))
+	for i, s := range elasticbook.Sorts {
+		ns[i] = string(s)
 	}
+	return strings.Join(ns, "|")
 }
 
-func aliases() (*elasticbook.Client, []string) {
-	c, err := elasticbook.ClientRemote()
+// startWeb serves the web interface until it is killed
+func startWeb() error {
+	// Ctrl-C stops the server
+	stop()
+
+	_, filename, _, _ := runtime.Caller(0)
+	templateDir := filepath.Join(filename, "..", "..", "..", "web", "templates")
+	publicDir := filepath.Join(filename, "..", "..", "..", "web", "public")
+	b, err := backend()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
-	var ics []string
-	ics, err = c.Aliases()
+	defer closeBackend(b)
+	wapp, err := web.NewApp(
+		web.SetBackend(b),
+		web.SetVerbose(false),
+		web.SetPublicDir(publicDir),
+		web.SetTemplateDir(templateDir))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return failf("Unable to start WebInterface: %s", err)
+	}
+	if err := wapp.Start(); err != nil {
+		return failf("Unable to start WebInterface: %s", err)
+	}
+	return nil
+}
+
+// alias adds an alias to an index; the missing names are asked
+func alias(indexName string, aliasName string) error {
+	c, err := backend()
+	if err != nil {
+		return err
+	}
+	defer closeBackend(c)
+
+	if indexName == "" {
+		if err := needTerminal("--index"); err != nil {
+			return err
+		}
+		if indexName, err = chooseIndex(c); err != nil {
+			return err
+		}
+	}
+	if aliasName == "" {
+		if err := needTerminal("--name"); err != nil {
+			return err
+		}
+		if aliasName, err = askForString("Alias name"); err != nil {
+			return err
+		}
+	}
+
+	if aliasName == c.AliasName() {
+		return failf(
+			"%s is the default alias name. Use `default set` to assign the default index",
+			aliasName)
+	}
+
+	ack, err := c.AliasContext(ctx, indexName, aliasName)
+	if errors.Is(err, elasticbook.ErrAliasConflict) {
+		return failf("Cannot create your alias: %s is already there", aliasName)
+	} else if err != nil {
+		return fail(err)
+	}
+
+	if !ack {
+		return failf("Cannot create your alias. Maybe is already there...")
+	}
+	return aliases(c)
+}
+
+func aliases(c elasticbook.Backend) error {
+	ics, err := c.AliasesContext(ctx)
+	if err != nil {
+		return fail(err)
 	}
 	cyan := color.New(color.FgCyan).SprintFunc()
 	green := color.New(color.FgGreen).SprintFunc()
@@ -186,147 +676,487 @@ func aliases() (*elasticbook.Client, []string) {
 			cyan(index), green(xs[0]), yellow(xs[1]))
 	}
 
-	return c, ics
+	return nil
+}
+
+// interactive tells if the missing arguments can be asked: the standard
+// input is a terminal
+func interactive() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// needTerminal fails if the argument is missing and nobody can be asked
+// for it (e.g. in cron or CI)
+func needTerminal(arg string) error {
+	if interactive() {
+		return nil
+	}
+	return usagef("Missing %s (no terminal to ask for it)", arg)
 }
 
 // askForConfirmation uses Scanln to parse user input. A user must type
 // in "yes" or "no" and then press enter. It has fuzzy matching, so "y",
 // "Y", "yes", "YES", and "Yes" all count as confirmations. If the input
 // is not recognized, it will ask again. The function does not return
-// until it gets a valid response from the user. Typically, you should
-// use fmt to print out a question before calling askForConfirmation.
-// E.g. fmt.Println("WARNING: Are you sure? (yes/no)")
+// until it gets a valid response from the user (or the input ends).
+// Typically, you should use fmt to print out a question before calling
+// askForConfirmation. E.g. fmt.Println("WARNING: Are you sure? (yes/no)")
 func askForConfirmation() bool {
 	const dflt string = "no"
-	var response string
-
-	_, err := fmt.Scanln(&response)
-	if err != nil && err.Error() == "unexpected newline" {
-		response = dflt
-	}
 
 	nokayResponses := []string{"n", "N", "no", "No", "NO"}
 	okayResponses := []string{"y", "Y", "yes", "Yes", "YES"}
 
-	if utils.ContainsString(okayResponses, response) {
-		return true
-	} else if utils.ContainsString(nokayResponses, response) {
-		return false
-	} else {
+	for {
+		var response string
+		_, err := fmt.Scanln(&response)
+		if err == io.EOF {
+			return false
+		}
+		if err != nil && err.Error() == "unexpected newline" {
+			response = dflt
+		}
+
+		if utils.ContainsString(okayResponses, response) {
+			return true
+		} else if utils.ContainsString(nokayResponses, response) {
+			return false
+		}
 		fmt.Fprintf(os.Stdout, "Please type yes|no and then press enter: ")
 	}
-	return askForConfirmation()
 }
 
-func askForIndex(length int) int {
+func askForIndex(length int) (int, error) {
 	msg := ""
 	for {
 		fmt.Fprintf(os.Stdout, "[0-%02d]: %s ", length, msg)
 		var i int
 		_, err := fmt.Scanf("%d", &i)
+		if err == io.EOF {
+			return 0, errNoAnswer
+		}
 		if err == nil && i >= 0 && i <= length {
-			return i
+			return i, nil
 		}
 		msg = "(nope)"
 	}
 }
 
-func chooseCollection(cns []string) int {
-	for i, cn := range cns {
-		fmt.Fprintf(os.Stdout, "[%d] %s\n", i, cn)
+// askForString asks until a (single word) answer is given
+func askForString(prompt string) (string, error) {
+	for {
+		fmt.Fprintf(os.Stdout, "%s: ", prompt)
+		var s string
+		_, err := fmt.Scanln(&s)
+		if err == io.EOF {
+			return "", errNoAnswer
+		}
+		if err == nil && s != "" {
+			return s, nil
+		}
+	}
+}
+
+// chooseIndex lists the indices, with their aliases, and asks for one
+func chooseIndex(c elasticbook.Backend) (string, error) {
+	if err := aliases(c); err != nil {
+		return "", err
+	}
+	ics, err := c.IndexNamesContext(ctx)
+	if err != nil {
+		return "", fail(err)
+	}
+	if len(ics) == 0 {
+		return "", failf("There are no indexes")
+	}
+
+	fmt.Fprintf(os.Stdout, "Index ")
+	i, err := askForIndex(len(ics) - 1)
+	if err != nil {
+		return "", err
+	}
+	return ics[i], nil
+}
+
+// clientContext connects to the cluster of the context picked with the
+// context flag (see elasticbook.ClientContext)
+func clientContext(options ...elasticbook.ClientOptionFunc) (*elasticbook.Client, error) {
+	if timeout > 0 {
+		options = append([]elasticbook.ClientOptionFunc{elasticbook.SetTimeout(timeout)}, options...)
+	}
+	return elasticbook.ClientContext(contextName, options...)
+}
+
+// cluster connects to the Elasticsearch cluster, for the commands the
+// embedded backend does not support
+func cluster(options ...elasticbook.ClientOptionFunc) (*elasticbook.Client, error) {
+	if backendName == embedded.BackendName {
+		return nil, failf("This command needs an Elasticsearch cluster (--backend elasticsearch)")
+	}
+	c, err := clientContext(options...)
+	if err != nil {
+		return nil, fail(err)
+	}
+	return c, nil
+}
+
+// engine opens the embedded backend
+func engine(options ...embedded.OptionFunc) (*embedded.Engine, error) {
+	e, err := embedded.Open(embedded.DefaultDir(), options...)
+	if err != nil {
+		return nil, fail(err)
+	}
+	return e, nil
+}
+
+// backend returns the Backend picked with the backend flag
+func backend() (elasticbook.Backend, error) {
+	if backendName == embedded.BackendName {
+		return engine()
+	}
+	return cluster()
+}
+
+// closeBackend releases the backend, if it holds something (e.g. the
+// embedded indices)
+func closeBackend(b elasticbook.Backend) {
+	if c, ok := b.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// bookmarksFilePath returns the Bookmarks file picked with the browser,
+// profile and bookmarks flags
+func bookmarksFilePath() (string, error) {
+	path, err := utils.BookmarksFileFor(browser, profile, bookmarks)
+	if err != nil {
+		return "", fail(err)
+	}
+	return path, nil
+}
+
+func bookmarksFile() ([]byte, error) {
+	path, err := bookmarksFilePath()
+	if err != nil {
+		return nil, err
+	}
+	return readFile(path)
+}
+
+// readFile reads a bookmarks file
+func readFile(path string) ([]byte, error) {
+	b, err := utils.ReadBookmarksFile(path)
+	if err != nil {
+		return nil, fail(err)
+	}
+	return b, nil
+}
+
+// sources parses the Bookmarks files picked with the flags: the explicit
+// files, all the profiles found or the (comma separated) profiles given
+func sources() ([]*elasticbook.Source, error) {
+	if bookmarks != "" || places != "" || htmlFile != "" {
+		var ss []*elasticbook.Source
+		if bookmarks != "" {
+			r, err := parseFile(bookmarks)
+			if err != nil {
+				return nil, err
+			}
+			ss = append(ss, elasticbook.NewSource("", "", r))
+		}
+		if places != "" {
+			p := firefox.ProfileOf(places)
+			r, err := parseProfile(p)
+			if err != nil {
+				return nil, err
+			}
+			ss = append(ss, elasticbook.NewSource(p.Browser, p.Name, r))
+		}
+		if htmlFile != "" {
+			b, err := readFile(htmlFile)
+			if err != nil {
+				return nil, err
+			}
+			r, err := netscape.Parse(b)
+			if err != nil {
+				return nil, failf("Your bookmarks.html (%s) cannot be parsed: %s", htmlFile, err.Error())
+			}
+			ss = append(ss, elasticbook.NewSource(netscape.BrowserName, filepath.Base(htmlFile), r))
+		}
+		return ss, nil
+	}
+
+	var ps []utils.Profile
+	if allProfiles {
+		var err error
+		if ps, err = allBrowserProfiles(); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, name := range strings.Split(profile, ",") {
+			var p utils.Profile
+			var err error
+			if strings.EqualFold(browser, firefox.BrowserName) {
+				p, err = firefox.FindProfile(strings.TrimSpace(name))
+			} else {
+				p, err = utils.FindProfile(browser, strings.TrimSpace(name))
+			}
+			if err != nil {
+				return nil, fail(err)
+			}
+			ps = append(ps, p)
+		}
+	}
+
+	ss := make([]*elasticbook.Source, len(ps))
+	for i, p := range ps {
+		r, err := parseProfile(p)
+		if err != nil {
+			return nil, err
+		}
+		ss[i] = elasticbook.NewSource(p.Browser, p.Name, r)
+	}
+	return ss, nil
+}
+
+// allBrowserProfiles returns the Chromium based and the Firefox profiles
+func allBrowserProfiles() ([]utils.Profile, error) {
+	ps, err := utils.Profiles()
+	if err != nil {
+		return nil, fail(err)
+	}
+	fps, err := firefox.Profiles()
+	if err != nil {
+		return nil, fail(err)
 	}
-	fmt.Fprintf(os.Stdout, "----\n")
-	return askForIndex(len(cns))
+	return append(ps, fps...), nil
 }
 
-func count() {
+func parseProfile(p utils.Profile) (*elasticbook.Root, error) {
+	if p.Browser != firefox.BrowserName {
+		return parseFile(p.Path)
+	}
+
+	r, err := firefox.Parse(p.Path)
+	if err != nil {
+		return nil, failf("Your Firefox DB (%s) cannot be parsed: %s", p.Path, err.Error())
+	}
+	return r, nil
+}
+
+func parseFile(path string) (*elasticbook.Root, error) {
+	b, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := elasticbook.Parse(b)
+	if err == elasticbook.ErrChecksumMismatch {
+		fmt.Fprintf(os.Stderr, "Your Bookmarks DB (%s): %s\n\n", path, err.Error())
+	} else if err != nil {
+		return nil, failf("Your Bookmarks DB (%s) cannot be parsed, sorry", path)
+	}
+	return r, nil
+}
+
+func count() error {
 	// TODO: also check local if you want
-	fmt.Fprintf(os.Stdout, "Working on %s\n", utils.BookmarksFilePath())
-	c, err := elasticbook.ClientRemote()
+	path, err := bookmarksFilePath()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
-	b := utils.BookmarksFile()
-	r, err := c.Parse(b)
+	fmt.Fprintf(os.Stdout, "Working on %s\n", path)
+	r, err := parseFile(path)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Your Bookmarks DB cannot be parsed, sorry\n\n")
-		os.Exit(1)
+		return err
 	}
 
 	n := r.Count()
 	fmt.Fprintf(os.Stdout, "%+v", n)
+	return nil
 }
 
-func defaultAlias() {
-	aliases()
+// defaultAlias points the default alias to an index; it is asked if
+// missing
+func defaultAlias(indexName string) error {
+	c, err := backend()
+	if err != nil {
+		return err
+	}
+	defer closeBackend(c)
+
+	if indexName == "" {
+		if err := needTerminal("INDEX"); err != nil {
+			return err
+		}
+		if indexName, err = chooseIndex(c); err != nil {
+			return err
+		}
+	}
 
-	c, err := elasticbook.ClientRemote()
+	ack, err := c.DefaultContext(ctx, indexName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return fail(err)
 	}
 
-	fmt.Fprintf(os.Stdout, "Index name: ")
-	icNames, _ := c.IndexNames()
-	i := askForIndex(len(icNames) - 1)
-	indexName := icNames[i]
+	if !ack {
+		return failf("Cannot switch default alias")
+	}
+	return aliases(c)
+}
 
-	ack, err := c.Default(indexName)
+// deleteIndex drops an index, after a confirmation unless yes is set; the
+// index is asked if missing
+func deleteIndex(indexName string, yes bool) error {
+	c, err := backend()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
+	defer closeBackend(c)
 
-	if ack {
-		aliases()
-	} else {
-		fmt.Fprintf(os.Stderr, "Cannot switch default alias")
-		os.Exit(1)
+	if indexName == "" {
+		if err := needTerminal("INDEX"); err != nil {
+			return err
+		}
+		if indexName, err = chooseIndex(c); err != nil {
+			return err
+		}
+	}
+
+	if !yes {
+		if !interactive() {
+			return usagef("Not deleting %s without --yes (no terminal to ask)", indexName)
+		}
+		fmt.Fprintf(os.Stdout, "Want to delete the %s index? [y/N]: ", indexName)
+		if !askForConfirmation() {
+			fmt.Fprintf(os.Stdout, "Whatever\n\n")
+			return nil
+		}
+	}
+
+	if err := c.DeleteContext(ctx, indexName); err != nil {
+		return fail(err)
 	}
+	fmt.Fprintf(os.Stdout, "Index %s deleted\n", indexName)
+	return nil
 }
 
-func deleteIndex() {
-	c, ics := indices()
-	if len(ics) == 0 {
-		fmt.Fprintf(os.Stderr, "There are no indexes\n")
-		os.Exit(1)
+func doctor(fix bool) error {
+	c, err := cluster()
+	if err != nil {
+		return err
+	}
+	ds, err := c.DoctorContext(ctx, fix)
+	if err != nil {
+		return fail(err)
+	}
+	if len(ds) == 0 {
+		fmt.Fprintf(os.Stdout, "Everything looks fine\n")
+		return nil
 	}
 
-	icNames, _ := c.IndexNames()
-	i := askForIndex(len(icNames) - 1)
-	indexName := icNames[i]
-	fmt.Fprintf(os.Stdout, "Want to delete the %s index? [y/N]: ", indexName)
-	if askForConfirmation() {
-		c.Delete(indexName)
+	cyan := color.New(color.FgCyan).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	for i, d := range ds {
+		index := fmt.Sprintf("%02d", i)
+		fmt.Fprintf(os.Stdout, "%s] - %s\n", cyan(index), yellow(d.Problem))
+		if d.Repair == "" {
+			continue
+		}
+		if d.Err != nil {
+			fmt.Fprintf(os.Stdout, "      %s (%s)\n", red(d.Repair), d.Err.Error())
+		} else if d.Repaired {
+			fmt.Fprintf(os.Stdout, "      %s (done)\n", green(d.Repair))
+		} else {
+			fmt.Fprintf(os.Stdout, "      %s (use --fix)\n", d.Repair)
+		}
+	}
+	return nil
+}
+
+// export writes an index, or the results of a search, in the given format.
+// A chrome Bookmarks file is replaced atomically, with a backup.
+func export(indexName, format, output, term string, o elasticbook.SearchOptions) error {
+	w := os.Stdout
+	if output != "" && format != "chrome" {
+		f, err := os.Create(output)
+		if err != nil {
+			return fail(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	var e elasticbook.Exporter
+	var tree *elasticbook.Tree
+	switch format {
+	case "chrome":
+		tree = elasticbook.NewTree()
+		e = tree
+	case "html":
+		e = netscape.NewExporter(w)
+	case "json":
+		e = elasticbook.NewJSONExporter(w)
+	case "csv":
+		e = elasticbook.NewCSVExporter(w)
+	default:
+		return failf("Format %s not supported (html|json|csv|chrome)", format)
+	}
+
+	c, err := backend()
+	if err != nil {
+		return err
+	}
+	defer closeBackend(c)
+
+	var n int
+	if term != "" {
+		n, err = elasticbook.ExportSearchContext(ctx, c, term, o, e)
 	} else {
-		fmt.Fprintf(os.Stdout, "Whatever\n\n")
+		if indexName == "" {
+			indexName = c.AliasName()
+		}
+		n, err = elasticbook.ExportContext(ctx, c, indexName, e)
+	}
+	if err == nil && tree != nil {
+		if output != "" {
+			err = tree.Root().WriteFile(output)
+		} else {
+			var b []byte
+			b, err = tree.Root().Marshal()
+			w.Write(b)
+		}
 	}
+	if err != nil {
+		return fail(err)
+	}
+	if output != "" {
+		fmt.Fprintf(os.Stdout, "%d bookmarks exported to %s\n", n, output)
+	}
+	return nil
 }
 
-func health() {
-	// TODO: also check local if you want
-	c, err := elasticbook.ClientRemote()
+func health() error {
+	c, err := cluster()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
-	h, err := c.Health()
+	h, err := c.HealthContext(ctx)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return fail(err)
 	}
 	fmt.Fprintf(os.Stdout, "%+v\n\n", h)
+	return nil
 }
 
-func indices() (*elasticbook.Client, []string) {
-	c, err := elasticbook.ClientRemote()
+func indices(c elasticbook.Backend) error {
+	ics, err := c.IndicesContext(ctx)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return fail(err)
 	}
-	var ics []string
-	ics, err = c.Indices()
 	cyan := color.New(color.FgCyan).SprintFunc()
 	green := color.New(color.FgGreen).SprintFunc()
 
@@ -335,43 +1165,74 @@ func indices() (*elasticbook.Client, []string) {
 		fmt.Fprintf(os.Stdout, "%s] - %s\n",
 			cyan(index), green(x))
 	}
-	return c, ics
+	return nil
 }
 
-func index() {
-	// TODO: also check local if you want
-	c, err := elasticbook.ClientRemote()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+// index builds a new index. With swap, the default alias is switched to
+// it once verified (see Client.Reindex).
+func index(swap bool, options ...elasticbook.ClientOptionFunc) error {
+	var b elasticbook.Backend
+	var c *elasticbook.Client
+	if backendName == embedded.BackendName && !swap {
+		e, err := engine(
+			embedded.SetBatchSize(bulkActions),
+			embedded.SetMaxFailures(maxFailures),
+			embedded.SetKeepAborted(keepAborted))
+		if err != nil {
+			return err
+		}
+		defer closeBackend(e)
+		b = e
+	} else {
+		var err error
+		if c, err = cluster(options...); err != nil {
+			return err
+		}
+		b = c
 	}
-	b := utils.BookmarksFile()
-	r, err := c.Parse(b)
+	ss, err := sources()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Your Bookmarks DB cannot be parsed, sorry\n\n")
-		os.Exit(1)
+		return err
 	}
-	_, err = c.Index(r)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+	var rep *elasticbook.IndexReport
+	if swap {
+		rep, err = c.ReindexContext(ctx, ss...)
 	} else {
-		fmt.Fprintf(os.Stdout, "Index created \n")
+		rep, err = b.IndexContext(ctx, ss...)
+	}
+	if rep != nil {
+		red := color.New(color.FgRed).SprintFunc()
+		for _, f := range rep.Failed {
+			fmt.Fprintf(os.Stderr, "%s] - %s\n", red(f.ID), f.Reason)
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		return failf("Interrupted: the partial index has been discarded")
 	}
-	count := r.Count()
-	fmt.Fprintf(os.Stdout, "%+v", count)
+	if err != nil {
+		return fail(err)
+	}
+
+	fmt.Fprintf(os.Stdout, "Index %s created: %d indexed, %d failed\n",
+		rep.IndexName, len(rep.Succeeded), len(rep.Failed))
+	if swap {
+		fmt.Fprintf(os.Stdout, "Index %s is now the %s\n",
+			rep.IndexName, c.AliasName())
+	}
+	for _, s := range ss {
+		fmt.Fprintf(os.Stdout, "%s\n%+v", s, s.Root.Count())
+	}
+	return nil
 }
 
-func mappings() {
-	c, err := elasticbook.ClientRemote()
+func mappings() error {
+	c, err := cluster()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
-	mpgs, err := c.Mappings()
+	mpgs, err := c.MappingsContext(ctx)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return fail(err)
 	}
 	cyan := color.New(color.FgCyan).SprintFunc()
 	green := color.New(color.FgGreen).SprintFunc()
@@ -384,19 +1245,21 @@ func mappings() {
 			cyan(index), green(k), yellow(v))
 		i++
 	}
+	return nil
 }
 
-func parse() {
-	// TODO: also check local if you want
-	c, err := elasticbook.ClientRemote()
+func parse() error {
+	b, err := bookmarksFile()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
-
-	b := utils.BookmarksFile()
-	cr, err := c.Parse(b)
-	if err != nil {
+	cr, err := elasticbook.Parse(b)
+	if err == elasticbook.ErrChecksumMismatch {
+		fmt.Fprintf(
+			os.Stderr,
+			"Your Bookmarks DB may be corrupted (%s): %d bookmarks found\n\n",
+			err.Error(), cr.Count().Total())
+	} else if err != nil {
 		fmt.Fprintf(os.Stderr, "Your Bookmarks DB cannot be parsed, sorry\n\n")
 	} else {
 		fmt.Fprintf(
@@ -404,86 +1267,142 @@ func parse() {
 			"Your Bookmarks DB seems healthy: %d bookmarks found\n\n",
 			cr.Count().Total())
 	}
+	return nil
 }
 
-func persist() {
-	db, err := bolt.Open("db/my.db", 0600, &bolt.Options{Timeout: 1 * time.Second})
+func profiles() error {
+	ps, err := allBrowserProfiles()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if len(ps) == 0 {
+		return failf("No browser profiles found")
 	}
-	defer db.Close()
 
-	db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("MyBucket"))
-		err := b.Put([]byte("answer"), []byte("42"))
+	cyan := color.New(color.FgCyan).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	for i, p := range ps {
+		index := fmt.Sprintf("%02d", i)
+		fmt.Fprintf(os.Stdout, "%s] - %s %s (%s)\n",
+			cyan(index), green(p.Browser), yellow(p.Name), p.Path)
+	}
+	return nil
+}
+
+func prune(o elasticbook.PruneOptions) error {
+	c, err := cluster()
+	if err != nil {
 		return err
-	})
+	}
+	pruned, err := c.PruneContext(ctx, o)
+	if err != nil {
+		return fail(err)
+	}
 
-	db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("MyBucket"))
-		v := b.Get([]byte("answer"))
-		fmt.Printf("The answer is: %s\n", v)
-		return nil
-	})
+	verb := "deleted"
+	if o.DryRun {
+		verb = "would be deleted"
+	}
+	cyan := color.New(color.FgCyan).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	for i, x := range pruned {
+		index := fmt.Sprintf("%02d", i)
+		fmt.Fprintf(os.Stdout, "%s] - %s (%s)\n", cyan(index), green(x), verb)
+	}
+	fmt.Fprintf(os.Stdout, "%d indices %s\n", len(pruned), verb)
+	return nil
 }
 
-func unalias() {
-	// TODO: maybe avoid multiple connections?
-	aliases()
+func syncIndex(options ...elasticbook.ClientOptionFunc) error {
+	c, err := cluster(options...)
+	if err != nil {
+		return err
+	}
+	ss, err := sources()
+	if err != nil {
+		return err
+	}
 
-	c, err := elasticbook.ClientRemote()
+	rep, err := c.SyncContext(ctx, ss...)
+	if rep != nil {
+		red := color.New(color.FgRed).SprintFunc()
+		for _, f := range rep.Failed {
+			fmt.Fprintf(os.Stderr, "%s] - %s\n", red(f.ID), f.Reason)
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		return failf("Interrupted: run sync again to finish the job")
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return fail(err)
 	}
 
-	var aliasName string
+	if rep.UpToDate {
+		fmt.Fprintf(os.Stdout, "Index %s is up to date\n", rep.IndexName)
+		return nil
+	}
+	fmt.Fprintf(os.Stdout,
+		"Index %s synced: %d added, %d updated, %d deleted, %d unchanged, %d failed\n",
+		rep.IndexName, len(rep.Added), len(rep.Updated), len(rep.Deleted),
+		rep.Unchanged, len(rep.Failed))
+	return nil
+}
 
-	fmt.Fprintf(os.Stdout, "Delete alias name: ")
-	_, err = fmt.Scanln(&aliasName)
-	if err != nil && err.Error() == "unexpected newline" {
-		unalias()
+// unalias removes an alias; it is asked if missing
+func unalias(aliasName string) error {
+	c, err := backend()
+	if err != nil {
+		return err
 	}
+	defer closeBackend(c)
 
-	if aliasName == elasticbook.DefaultAliasName {
-		fmt.Fprintf(
-			os.Stderr,
-			"%s is the default alias name. Do not delete this, please\n",
+	if aliasName == "" {
+		if err := needTerminal("ALIAS"); err != nil {
+			return err
+		}
+		if err := aliases(c); err != nil {
+			return err
+		}
+		if aliasName, err = askForString("Delete alias name"); err != nil {
+			return err
+		}
+	}
+
+	if aliasName == c.AliasName() {
+		return failf(
+			"%s is the default alias name. Do not delete this, please",
 			aliasName)
-		unalias()
 	}
 
-	ack, err := c.Unalias(aliasName)
+	ack, err := c.UnaliasContext(ctx, aliasName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return fail(err)
 	}
 
-	if ack {
-		aliases()
-	} else {
-		fmt.Fprintf(os.Stderr, "Cannot delete your alias")
-		os.Exit(1)
+	if !ack {
+		return failf("Cannot delete your alias")
 	}
+	return aliases(c)
 }
 
-func searchTerm(term string, verbose bool) {
-	// TODO: also check local if you want
-	c, err := elasticbook.ClientRemote()
+func searchTerm(term string, o elasticbook.SearchOptions, verbose bool) error {
+	c, err := backend()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
-	sr, err := c.Search(term)
+	defer closeBackend(c)
+	sr, err := c.SearchWithContext(ctx, term, o)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return fail(err)
 	}
 
 	fmt.Fprintf(os.Stdout, "Query took %d milliseconds\n", sr.TookInMillis)
 
-	if sr.Hits != nil {
-		fmt.Printf("Found a total of %d bookmarks\n", sr.Hits.TotalHits)
+	if sr.TotalHits > 0 {
+		fmt.Printf("Found a total of %d bookmarks (page %d, %d per page)\n",
+			sr.TotalHits, sr.Page, sr.Size)
 
 		// blue := color.New(color.FgBlue).SprintFunc()
 		red := color.New(color.FgRed).SprintFunc()
@@ -491,36 +1410,43 @@ func searchTerm(term string, verbose bool) {
 		green := color.New(color.FgGreen).SprintFunc()
 		yellow := color.New(color.FgYellow).SprintFunc()
 
-		for i, hit := range sr.Hits.Hits {
-			var t elasticbook.Bookmark
-			err := json.Unmarshal(*hit.Source, &t)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-			}
-
-			index := fmt.Sprintf("%02d", i)
-			fmt.Fprintf(os.Stdout, "%s] - %s [%s] (%s) {%s}\n",
-				cyan(index), green(t.Name), yellow(t.URL), t.DateAdded,
-				red(fmt.Sprintf("%f", *hit.Score)),
+		first := (sr.Page - 1) * sr.Size
+		for i, hit := range sr.Hits {
+			t := hit.Bookmark
+			index := fmt.Sprintf("%02d", first+i)
+			fmt.Fprintf(os.Stdout, "%s] - %s [%s] <%s> %s (%s) {%s}\n",
+				cyan(index), green(t.Name), yellow(t.URL), t.Folder,
+				elasticbook.NewSource(t.SourceBrowser, t.SourceProfile, nil),
+				t.DateAdded.Format(time.RFC1123),
+				red(fmt.Sprintf("%f", hit.Score)),
 				// red(strconv.FormatFloat(hit.Score, 'f', 6, 64)),
 			)
 			if verbose {
 				fmt.Fprintf(os.Stdout, "%v\n", hit.Explanation)
 			}
 		}
+		if sr.Next != "" {
+			fmt.Fprintf(os.Stdout, "Next page: --cursor %s\n", sr.Next)
+		}
+		if sr.Prev != "" {
+			fmt.Fprintf(os.Stdout, "Previous page: --cursor %s\n", sr.Prev)
+		}
 	} else {
 		// No hits
 		fmt.Print("Found no Bookmarks\n")
 	}
+	return nil
 }
 
-func version() {
-	// TODO: also check local if you want
-	c, err := elasticbook.ClientRemote()
+func version() error {
+	c, err := cluster()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return err
+	}
+	h, err := c.VersionContext(ctx)
+	if err != nil {
+		return fail(err)
 	}
-	h := c.Version()
 	fmt.Fprintf(os.Stdout, "Elasticsearch version %+v (%s)\n\n", h, c.URL())
+	return nil
 }
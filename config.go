@@ -0,0 +1,285 @@
+package elasticbook
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/olivere/elastic.v3"
+)
+
+// ConfigFileEnv overrides the path of the configuration file
+const ConfigFileEnv = "ELASTICBOOK_CONFIG"
+
+// ContextEnv picks the context used when none is given
+const ContextEnv = "ELASTICBOOK_CONTEXT"
+
+// ErrNoContext is returned when no context is given and the
+// configuration file has no current_context
+var ErrNoContext = errors.New("no context given and no current_context set")
+
+// Config is the content of the configuration file: a set of named
+// cluster contexts, e.g.
+//
+//	current_context = "bonsai"
+//
+//	[contexts.local]
+//	url = "http://127.0.0.1:9200"
+//
+//	[contexts.bonsai]
+//	url = "https://xyz.bonsai.io"
+//	username = "${BONSAIO_KEY}"
+//	password = "${BONSAIO_SECRET}"
+//	max_retries = 5
+//	timeout = "10s"
+//
+// Environment variables in url, username and password are expanded.
+type Config struct {
+	CurrentContext string              `toml:"current_context"`
+	Contexts       map[string]*Context `toml:"contexts"`
+}
+
+// Context describes how to reach a cluster and which names to use in it
+type Context struct {
+	URL      string `toml:"url"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	TLS      TLS    `toml:"tls"`
+
+	// IndexPrefix is the prefix of the timestamped indices
+	// (DefaultIndexName if empty)
+	IndexPrefix string `toml:"index_prefix"`
+	// AliasName is the alias used in Searches (DefaultAliasName if empty)
+	AliasName string `toml:"alias_name"`
+
+	// Sniff looks for the other nodes of the cluster (keep it off for
+	// hosted clusters behind a proxy)
+	Sniff bool `toml:"sniff"`
+	// MaxRetries is the number of retries of a failed request (the
+	// elastic default if zero)
+	MaxRetries int `toml:"max_retries"`
+
+	// Timeout bounds every request to the cluster, and IndexTimeout a
+	// whole Index, Reindex or Sync run (see SetTimeout and
+	// SetIndexTimeout; the defaults if zero)
+	Timeout      Duration `toml:"timeout"`
+	IndexTimeout Duration `toml:"index_timeout"`
+}
+
+// Duration is a time.Duration written as a string in the configuration
+// file, like "30s" or "5m" (see time.ParseDuration)
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses the duration
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+// TLS configures the HTTPS connection of a Context
+type TLS struct {
+	// CAFile is a PEM bundle of the trusted authorities (the system ones
+	// if empty)
+	CAFile string `toml:"ca_file"`
+	// CertFile and KeyFile are the client certificate, if required
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
+	// InsecureSkipVerify disables the server certificate check
+	InsecureSkipVerify bool `toml:"insecure_skip_verify"`
+}
+
+// DefaultConfigFile returns the path of the configuration file:
+// $ELASTICBOOK_CONFIG, or config.toml in the elasticbook directory of the
+// user configuration (see os.UserConfigDir): ~/.config/elasticbook on
+// Linux (or $XDG_CONFIG_HOME/elasticbook), ~/Library/Application
+// Support/elasticbook on OSX, %AppData%\elasticbook on Windows
+func DefaultConfigFile() string {
+	if p := os.Getenv(ConfigFileEnv); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		// No home directory: look in the current one
+		dir = "."
+	}
+	return filepath.Join(dir, "elasticbook", "config.toml")
+}
+
+// LoadConfig reads a configuration file. Unknown keys are an error (most
+// likely a typo).
+func LoadConfig(path string) (*Config, error) {
+	cfg := new(Config)
+	md, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if keys := md.Undecoded(); len(keys) > 0 {
+		ks := make([]string, len(keys))
+		for i, k := range keys {
+			ks[i] = k.String()
+		}
+		return nil, fmt.Errorf("%s: unknown keys %s", path, strings.Join(ks, ", "))
+	}
+	for name, ctx := range cfg.Contexts {
+		if ctx == nil || ctx.URL == "" {
+			return nil, fmt.Errorf("%s: context %s has no url", path, name)
+		}
+		ctx.URL = os.ExpandEnv(ctx.URL)
+		ctx.Username = os.ExpandEnv(ctx.Username)
+		ctx.Password = os.ExpandEnv(ctx.Password)
+	}
+	return cfg, nil
+}
+
+// Context returns the named context; an empty name means the
+// current_context
+func (cfg *Config) Context(name string) (*Context, error) {
+	if name == "" {
+		name = cfg.CurrentContext
+	}
+	if name == "" {
+		return nil, ErrNoContext
+	}
+	ctx, ok := cfg.Contexts[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown context %s (available: %s)",
+			name, strings.Join(cfg.Names(), ", "))
+	}
+	return ctx, nil
+}
+
+// Names returns the context names, sorted
+func (cfg *Config) Names() []string {
+	var names []string
+	for k := range cfg.Contexts {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// httpClient builds the HTTP client honouring the TLS settings
+func (t TLS) httpClient() (*http.Client, error) {
+	conf := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+	if t.CAFile != "" {
+		pem, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificate found", t.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: conf,
+	}}, nil
+}
+
+// SetContext connects the Client to the cluster of a context, with its
+// index prefix, alias name and timeouts
+func SetContext(ctx *Context) ClientOptionFunc {
+	return func(c *Client) error {
+		hc, err := ctx.TLS.httpClient()
+		if err != nil {
+			return err
+		}
+		options := []elastic.ClientOptionFunc{
+			elastic.SetURL(ctx.URL),
+			elastic.SetHttpClient(hc),
+			elastic.SetSniff(ctx.Sniff),
+			elastic.SetHealthcheckInterval(10 * time.Second),
+			elastic.SetErrorLog(log.New(os.Stderr, "[elastic] ", log.LstdFlags)),
+		}
+		if ctx.Username != "" || ctx.Password != "" {
+			options = append(options, elastic.SetBasicAuth(ctx.Username, ctx.Password))
+		}
+		if ctx.MaxRetries > 0 {
+			options = append(options, elastic.SetMaxRetries(ctx.MaxRetries))
+		}
+		if strings.HasPrefix(ctx.URL, "https") {
+			options = append(options, elastic.SetScheme("https"))
+		}
+
+		clnt, err := elastic.NewClient(options...)
+		if err != nil {
+			return fmt.Errorf(
+				"%w: unable to connect to ES cluster (%s): %s", ErrClusterUnreachable, ctx.URL, err)
+		}
+		c.client = clnt
+		c.remote = true
+		c.url = ctx.URL
+		if ctx.Timeout.Duration > 0 {
+			if err := SetTimeout(ctx.Timeout.Duration)(c); err != nil {
+				return err
+			}
+		}
+		if ctx.IndexTimeout.Duration > 0 {
+			if err := SetIndexTimeout(ctx.IndexTimeout.Duration)(c); err != nil {
+				return err
+			}
+		}
+		if err := SetIndexPrefix(ctx.IndexPrefix)(c); err != nil {
+			return err
+		}
+		return SetAliasName(ctx.AliasName)(c)
+	}
+}
+
+// SetConfig loads a context from a configuration file (the
+// current_context if name is empty) and applies it with SetContext
+func SetConfig(path string, name string) ClientOptionFunc {
+	return func(c *Client) error {
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			return err
+		}
+		ctx, err := cfg.Context(name)
+		if err != nil {
+			return err
+		}
+		return SetContext(ctx)(c)
+	}
+}
+
+// ClientContext connects to the cluster of the named context (the
+// current_context if the name is empty) of the configuration file.
+// Without a configuration file and a name, it falls back to ClientRemote
+// (the BONSAIO_* environment variables).
+//
+// Further options are applied after the context ones: a SetTimeout
+// overrides the timeout of the context.
+func ClientContext(name string, options ...ClientOptionFunc) (*Client, error) {
+	if name == "" {
+		name = os.Getenv(ContextEnv)
+	}
+	path := DefaultConfigFile()
+	if _, err := os.Stat(path); os.IsNotExist(err) && name == "" {
+		return ClientRemote(options...)
+	}
+	return NewClient(append([]ClientOptionFunc{
+		SetVerbose(false),
+		SetConfig(path, name)}, options...)...)
+}
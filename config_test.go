@@ -0,0 +1,46 @@
+package elasticbook_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zeroed/elasticbook"
+)
+
+func TestLoadConfigTimeouts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elasticbook-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+	conf := `current_context = "local"
+
+[contexts.local]
+url = "http://127.0.0.1:9200"
+timeout = "10s"
+index_timeout = "5m"
+`
+	if err := ioutil.WriteFile(path, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := elasticbook.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := cfg.Context("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Timeout.Duration != 10*time.Second {
+		t.Errorf("Timeout = %s, want 10s", ctx.Timeout.Duration)
+	}
+	if ctx.IndexTimeout.Duration != 5*time.Minute {
+		t.Errorf("IndexTimeout = %s, want 5m", ctx.IndexTimeout.Duration)
+	}
+}
@@ -0,0 +1,72 @@
+package elasticbook
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayouts are the absolute dates accepted by ParseDate
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// ParseDate parses a bound of a time ranged search (see SearchOptions):
+// an absolute date, like "2016-01-02" (in the location of now), or an
+// expression relative to now, like "today", "yesterday", "last week",
+// "last 3 months" or "2 days ago".
+func ParseDate(expr string, now time.Time) (time.Time, error) {
+	s := strings.TrimSpace(expr)
+	for _, l := range dateLayouts {
+		if t, err := time.ParseInLocation(l, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	s = strings.ToLower(s)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch s {
+	case "now":
+		return now, nil
+	case "today":
+		return midnight, nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), nil
+	}
+
+	var n, unit string
+	fs := strings.Fields(s)
+	switch {
+	case len(fs) == 2 && fs[0] == "last":
+		n, unit = "1", fs[1]
+	case len(fs) == 3 && fs[0] == "last":
+		n, unit = fs[1], fs[2]
+	case len(fs) == 3 && fs[2] == "ago":
+		n, unit = fs[0], fs[1]
+	default:
+		return time.Time{}, fmt.Errorf("%w: %q", ErrUnparseableDate, expr)
+	}
+	k, err := strconv.Atoi(n)
+	if err != nil || k < 0 {
+		return time.Time{}, fmt.Errorf("%w: %q", ErrUnparseableDate, expr)
+	}
+
+	switch strings.TrimSuffix(unit, "s") {
+	case "hour":
+		return now.Add(-time.Duration(k) * time.Hour), nil
+	case "day":
+		return now.AddDate(0, 0, -k), nil
+	case "week":
+		return now.AddDate(0, 0, -7*k), nil
+	case "month":
+		return now.AddDate(0, -k, 0), nil
+	case "year":
+		return now.AddDate(-k, 0, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: %q (unknown unit %s)", ErrUnparseableDate, expr, unit)
+}
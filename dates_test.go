@@ -0,0 +1,45 @@
+package elasticbook_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zeroed/elasticbook"
+)
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2016, 3, 31, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		expr    string
+		want    time.Time
+		wantErr error
+	}{
+		{expr: "2016-01-02", want: time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{expr: "2016-01", want: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "2015", want: time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "2016-01-02T10:00:00+01:00", want: time.Date(2016, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{expr: "now", want: now},
+		{expr: "today", want: time.Date(2016, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{expr: "Yesterday", want: time.Date(2016, 3, 30, 0, 0, 0, 0, time.UTC)},
+		{expr: "last week", want: time.Date(2016, 3, 24, 15, 4, 5, 0, time.UTC)},
+		{expr: "last 3 months", want: time.Date(2015, 12, 31, 15, 4, 5, 0, time.UTC)},
+		{expr: "2 days ago", want: time.Date(2016, 3, 29, 15, 4, 5, 0, time.UTC)},
+		{expr: "1 year ago", want: time.Date(2015, 3, 31, 15, 4, 5, 0, time.UTC)},
+		{expr: "last 2 fortnights", wantErr: elasticbook.ErrUnparseableDate},
+		{expr: "soon", wantErr: elasticbook.ErrUnparseableDate},
+		{expr: "last -1 days", wantErr: elasticbook.ErrUnparseableDate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := elasticbook.ParseDate(tt.expr, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseDate(%q) error = %v, want %v", tt.expr, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseDate(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package elasticbook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zeroed/elasticbook/utils"
+)
+
+// Diagnosis is a problem found by the Doctor and the way to fix it
+type Diagnosis struct {
+	// Problem describes what is wrong
+	Problem string
+	// Repair describes the fix ("" if the Doctor cannot fix it)
+	Repair string
+	// Repaired is true if the fix has been applied
+	Repaired bool
+	// Err is the error got applying the fix
+	Err error
+
+	fix func() error
+}
+
+func (d *Diagnosis) String() string {
+	if d.Repair == "" {
+		return d.Problem
+	}
+	return fmt.Sprintf("%s => %s", d.Problem, d.Repair)
+}
+
+// Doctor is DoctorContext with a background context
+func (c *Client) Doctor(fix bool) ([]*Diagnosis, error) {
+	return c.DoctorContext(context.Background(), fix)
+}
+
+// DoctorContext looks for broken states of the indices and aliases:
+//   - no index (or more than one) holding the default alias
+//   - the default index being empty or without the bookmark mapping
+//   - the stray alias named after the index prefix added by the first Index run
+//   - the indices left behind by an aborted Index run
+//
+// If fix is true the repairs are applied (e.g. the default alias is
+// pointed to the newest healthy index).
+func (c *Client) DoctorContext(ctx context.Context, fix bool) ([]*Diagnosis, error) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
+	ia, err := c.indexAliases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for k := range ia {
+		if strings.HasPrefix(k, c.indexPrefix+"-") {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	var ds []*Diagnosis
+	var healthy []string
+	var defaults []string
+
+	for _, n := range names {
+		vs := ia[n]
+		if utils.ContainsString(vs, c.aliasName) {
+			defaults = append(defaults, n)
+		}
+		if utils.ContainsString(vs, AbortedAliasName) {
+			n := n
+			ds = append(ds, &Diagnosis{
+				Problem: fmt.Sprintf("Index %s is left from an aborted run", n),
+				Repair:  fmt.Sprintf("delete %s", n),
+				fix: func() error {
+					_, err := c.client.DeleteIndex(n).DoC(ctx)
+					return err
+				},
+			})
+			continue
+		}
+
+		problem, err := c.checkIndex(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		if problem != "" {
+			ds = append(ds, &Diagnosis{Problem: problem})
+			continue
+		}
+		healthy = append(healthy, n)
+	}
+
+	var newest string
+	if len(healthy) > 0 {
+		newest = healthy[len(healthy)-1]
+	}
+
+	var problem string
+	switch {
+	case len(defaults) == 0:
+		problem = fmt.Sprintf("No index holds the %s alias", c.aliasName)
+	case len(defaults) > 1:
+		problem = fmt.Sprintf("Alias %s is on %d indices (%s)",
+			c.aliasName, len(defaults), strings.Join(defaults, ", "))
+	case !utils.ContainsString(healthy, defaults[0]):
+		problem = fmt.Sprintf("Alias %s is on the unhealthy index %s",
+			c.aliasName, defaults[0])
+	}
+	if problem != "" {
+		d := &Diagnosis{Problem: problem}
+		if newest != "" {
+			d.Repair = fmt.Sprintf("point %s to %s", c.aliasName, newest)
+			d.fix = func() error {
+				_, err := c.DefaultContext(ctx, newest)
+				return err
+			}
+		}
+		ds = append(ds, d)
+	}
+
+	for _, n := range names {
+		if utils.ContainsString(ia[n], c.indexPrefix) {
+			n := n
+			ds = append(ds, &Diagnosis{
+				Problem: fmt.Sprintf("Index %s holds the stray %s alias", n, c.indexPrefix),
+				Repair:  fmt.Sprintf("remove the %s alias", c.indexPrefix),
+				fix: func() error {
+					_, err := c.client.Alias().Remove(n, c.indexPrefix).DoC(ctx)
+					return err
+				},
+			})
+		}
+	}
+
+	if fix {
+		for _, d := range ds {
+			if d.fix == nil {
+				continue
+			}
+			d.Err = d.fix()
+			d.Repaired = d.Err == nil
+		}
+	}
+
+	return ds, nil
+}
+
+// checkIndex returns a description of what's wrong with the index ("" if
+// it's healthy)
+func (c *Client) checkIndex(ctx context.Context, indexName string) (string, error) {
+	client := c.client
+
+	ms, err := client.GetMapping().Index(indexName).DoC(ctx)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(ms[indexName])
+	if err != nil {
+		return "", err
+	}
+	var m struct {
+		Mappings map[string]interface{} `json:"mappings"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", err
+	}
+	if _, ok := m.Mappings[TypeName]; !ok {
+		return fmt.Sprintf("Index %s has no %s mapping", indexName, TypeName), nil
+	}
+
+	n, err := client.Count(indexName).Type(TypeName).DoC(ctx)
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return fmt.Sprintf("Index %s is empty", indexName), nil
+	}
+
+	return "", nil
+}
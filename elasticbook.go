@@ -12,20 +12,21 @@ package elasticbook
 // DONE: add default alias creation
 // DONE: add alias switch
 // DONE: add alias check for double/existing
-// TODO: add query time ranged
-// TODO: add fulltext search
+// DONE: add query time ranged
+// DONE: add fulltext search
 // DONE: add query CLI
 // DONE: add web interface
 // TODO: refactor doubled code
-// TODO: add Doctor for recovery/rollback default index
+// DONE: add Doctor for recovery/rollback default index
 // DONE: add safety check when switching alias
 // DONE: add 'by-index' in alias CLI
 // DONE: add 'by-index' in defaultAlias CLI
-// TODO: search sentences
+// DONE: search sentences
 // TODO: pay Bonsai.io monthly plan ($50/month ... cool story Bro)
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -50,12 +51,39 @@ const DefaultIndexName = "elasticbook"
 // DefaultAliasName is the Elasticsearch alias used in Searches
 const DefaultAliasName = "elasticbookdefault"
 
+// AbortedAliasName marks the indices left behind by an aborted Index run
+const AbortedAliasName = "elasticbookaborted"
+
 // TypeName is the type used
 const TypeName = "bookmark"
 
+// FolderNodeType is the Chrome node type of a folder (it has children)
+const FolderNodeType = "folder"
+
+// URLNodeType is the Chrome node type of a bookmark (it has an URL)
+const URLNodeType = "url"
+
+// PathSeparator joins the folder names in the indexed "folder" field
+const PathSeparator = "/"
+
+// EscapedPathSeparator replaces the PathSeparator inside a folder name
+// (see EscapeFolderName)
+const EscapedPathSeparator = "%2F"
+
 // DefaultFields is where to look when looking for bookmarks
 var DefaultFields = []string{"name", "url"}
 
+// The keys of the root folders in the Bookmarks file
+const (
+	BookmarkBarKey = "bookmark_bar"
+	SyncedKey      = "synced"
+	OtherKey       = "other"
+)
+
+// RootKeys are the keys of the root folders in the Bookmarks file (same
+// order of Roots.Folders)
+var RootKeys = []string{BookmarkBarKey, SyncedKey, OtherKey}
+
 // Root is the root of the Bookmarks tree
 type Root struct {
 	Checksum string `json:"checksum"`
@@ -66,21 +94,34 @@ type Root struct {
 // Count returns a map with the RootFolder name and the count
 func (r *Root) Count() (c *CountResult) {
 	c = new(CountResult)
-	c.Add(r.Roots.BookmarkBar.Name, len(r.Roots.BookmarkBar.Children))
-	c.Add(r.Roots.Other.Name, len(r.Roots.Other.Children))
-	c.Add(r.Roots.Synced.Name, len(r.Roots.Synced.Children))
+	for _, b := range r.Roots.Folders() {
+		c.Add(b.Name, b.Count())
+	}
 
 	return
 }
 
+// Walk visits every URL node of every root folder, in depth-first order
+func (r *Root) Walk(fn func(b *Bookmark, l Location)) {
+	for i, b := range r.Roots.Folders() {
+		walk(b.Children, Location{Root: RootKeys[i], Path: []string{b.Name}}, fn)
+	}
+}
+
 // Roots is the container of the 4 main bookmark structure (high level)
 type Roots struct {
 	BookmarkBar            Base   `json:"bookmark_bar"`
 	Other                  Base   `json:"other"`
-	SyncTransactionVersion string `json:"sync_transaction_version"`
+	SyncTransactionVersion string `json:"sync_transaction_version,omitempty"`
 	Synced                 Base   `json:"synced"`
 }
 
+// Folders returns the root folders in the same order used for indexing
+// (same order of RootKeys)
+func (r *Roots) Folders() []*Base {
+	return []*Base{&r.BookmarkBar, &r.Synced, &r.Other}
+}
+
 // Base is a "folder-like" container of Bookmarks
 type Base struct {
 	Children     []Bookmark `json:"children"`
@@ -91,19 +132,92 @@ type Base struct {
 	NodeType     string     `json:"type"`
 }
 
+// Count returns the number of URL nodes in the folder, subfolders
+// included
+func (b *Base) Count() int {
+	var n int
+	walk(b.Children, Location{}, func(*Bookmark, Location) { n++ })
+	return n
+}
+
 func (b *Base) String() string {
-	return fmt.Sprintf("%s (%d)", b.Name, len(b.Children))
+	return fmt.Sprintf("%s (%d)", b.Name, b.Count())
 }
 
-// Bookmark is a bookmark entry
+// Bookmark is a node of the Bookmarks tree: an URL entry or a folder
+// (with NodeType "folder", no URL and some Children)
 type Bookmark struct {
-	DateAdded              string `json:"date_added"`
-	OriginalID             string `json:"id"`
-	MetaInfo               Meta   `json:"meta_info,omitempty"`
-	Name                   string `json:"name"`
-	SyncTransactionVersion string `json:"sync_transaction_version"`
-	Type                   string `json:"type"`
-	URL                    string `json:"url"`
+	Children               []Bookmark `json:"children,omitempty"`
+	DateAdded              string     `json:"date_added"`
+	DateModified           string     `json:"date_modified,omitempty"`
+	Icon                   string     `json:"icon,omitempty"`
+	OriginalID             string     `json:"id"`
+	Keyword                string     `json:"keyword,omitempty"`
+	MetaInfo               Meta       `json:"meta_info,omitempty"`
+	Name                   string     `json:"name"`
+	SyncTransactionVersion string     `json:"sync_transaction_version,omitempty"`
+	Tags                   []string   `json:"tags,omitempty"`
+	Type                   string     `json:"type"`
+	URL                    string     `json:"url"`
+}
+
+// IsFolder returns true if the node is a folder
+func (b *Bookmark) IsFolder() bool {
+	return b.Type == FolderNodeType
+}
+
+// Location is where a node lives in the Bookmarks tree
+type Location struct {
+	// Browser and Profile tag the Source of the tree (if any)
+	Browser string
+	Profile string
+	// Root is the key of the root folder (e.g. "bookmark_bar")
+	Root string
+	// Path contains the names of the ancestor folders, root folder first
+	// (e.g. ["Bookmarks Bar", "Work", "Go"])
+	Path []string
+}
+
+// Folder returns the Path joined with the PathSeparator, the names
+// escaped with EscapeFolderName
+func (l Location) Folder() string {
+	ns := make([]string, len(l.Path))
+	for i, n := range l.Path {
+		ns[i] = EscapeFolderName(n)
+	}
+	return strings.Join(ns, PathSeparator)
+}
+
+// EscapeFolderName replaces the PathSeparator in a folder name with the
+// EscapedPathSeparator: "CI/CD" would otherwise be taken for a CD folder
+// inside a CI one (in the folder_path analyzer and in the folder
+// filters). A search in it uses the escaped name: "Bookmarks Bar/CI%2FCD".
+func EscapeFolderName(name string) string {
+	return strings.Replace(name, PathSeparator, EscapedPathSeparator, -1)
+}
+
+// child returns the Location of the nodes inside the folder named name
+func (l Location) child(name string) Location {
+	p := make([]string, len(l.Path), len(l.Path)+1)
+	copy(p, l.Path)
+	return Location{
+		Browser: l.Browser,
+		Profile: l.Profile,
+		Root:    l.Root,
+		Path:    append(p, name),
+	}
+}
+
+// walk visits recursively the nodes, calling fn on the URL ones only
+func walk(bs []Bookmark, l Location, fn func(b *Bookmark, l Location)) {
+	for i := range bs {
+		b := &bs[i]
+		if b.IsFolder() {
+			walk(b.Children, l.child(b.Name), fn)
+			continue
+		}
+		fn(b, l)
+	}
 }
 
 // NameSuggest contains the input for the suggestion engine
@@ -123,10 +237,16 @@ type NameSuggest struct {
 	Oputput string   `json:"output"`
 }
 
-func (b *Bookmark) toIndexable() (bs *BookmarkIndexable) {
+func (b *Bookmark) toIndexable(l Location) (bs *BookmarkIndexable, err error) {
 	bs = new(BookmarkIndexable)
-	bs.DateAdded = timeParse(b.DateAdded)
+	bs.DateAdded, err = timeParse(b.DateAdded)
+	if err != nil {
+		return nil, err
+	}
+	bs.DateModified = b.DateModified
+	bs.Folder = l.Folder()
 	bs.OriginalID = b.OriginalID
+	bs.Keyword = b.Keyword
 	mis := b.MetaInfo.toIndexable()
 	bs.MetaInfo = *mis
 	bs.Name = b.Name
@@ -134,9 +254,15 @@ func (b *Bookmark) toIndexable() (bs *BookmarkIndexable) {
 		Input:   strings.Fields(stripchars(b.Name, ",.-_")),
 		Oputput: b.Name,
 	}
+	bs.Path = l.Path
+	bs.Root = l.Root
+	bs.SourceBrowser = l.Browser
+	bs.SourceProfile = l.Profile
 	bs.SyncTransactionVersion = b.SyncTransactionVersion
+	bs.Tags = b.Tags
 	bs.Type = b.Type
 	bs.URL = b.URL
+	bs.Domain = domain(b.URL)
 	return
 }
 
@@ -147,13 +273,22 @@ func (b *Bookmark) toIndexable() (bs *BookmarkIndexable) {
 //			Output("Cycling is a fun sport.")
 type BookmarkIndexable struct {
 	DateAdded              time.Time     `json:"date_added"`
+	DateModified           string        `json:"date_modified,omitempty"`
+	Folder                 string        `json:"folder"`
 	OriginalID             string        `json:"id"`
+	Keyword                string        `json:"keyword,omitempty"`
 	MetaInfo               MetaIndexable `json:"meta_info,omitempty"`
 	Name                   string        `json:"name"`
 	NameSuggest            NameSuggest   `json:"name_suggest"`
+	Path                   []string      `json:"path"`
+	Root                   string        `json:"root"`
+	SourceBrowser          string        `json:"source_browser,omitempty"`
+	SourceProfile          string        `json:"source_profile,omitempty"`
 	SyncTransactionVersion string        `json:"sync_transaction_version"`
+	Tags                   []string      `json:"tags,omitempty"`
 	Type                   string        `json:"type"`
 	URL                    string        `json:"url"`
+	Domain                 string        `json:"domain,omitempty"`
 }
 
 // CountResult contains the bookmarks counter
@@ -188,11 +323,11 @@ func (c *CountResult) Total() int {
 
 // Meta contains the attached metadata to the Bookmark entry
 type Meta struct {
-	StarsID        string `json:"stars.id"`
-	StarsImageData string `json:"stars.imageData"`
-	StarsIsSynced  string `json:"stars.isSynced"`
-	StarsPageData  string `json:"stars.pageData"`
-	StarsType      string `json:"stars.type"`
+	StarsID        string `json:"stars.id,omitempty"`
+	StarsImageData string `json:"stars.imageData,omitempty"`
+	StarsIsSynced  string `json:"stars.isSynced,omitempty"`
+	StarsPageData  string `json:"stars.pageData,omitempty"`
+	StarsType      string `json:"stars.type,omitempty"`
 }
 
 func (m *Meta) toIndexable() (ms *MetaIndexable) {
@@ -216,7 +351,7 @@ type MetaIndexable struct {
 }
 
 // client is a connection builder
-func client(remote bool) *elastic.Client {
+func client(remote bool) (*elastic.Client, error) {
 	var clnt *elastic.Client
 	var url string
 	var err error
@@ -241,13 +376,11 @@ func client(remote bool) *elastic.Client {
 	}
 
 	if err != nil {
-		fmt.Fprintf(
-			os.Stderr,
-			"Unable to connect to ES cluster: (%s) %s ", url, err.Error())
-		os.Exit(1)
+		return nil, fmt.Errorf(
+			"%w: unable to connect to ES cluster (%s): %s", ErrClusterUnreachable, url, err)
 	}
 
-	return clnt
+	return clnt, nil
 }
 
 const (
@@ -259,6 +392,32 @@ const (
 
 	// DefaultVerbose decides if you wanna be bored by some noisy logs
 	DefaultVerbose = false
+
+	// DefaultBulkActions is the number of bookmarks sent in a bulk request
+	DefaultBulkActions = 500
+
+	// DefaultBulkFlushInterval is how often the pending bookmarks are
+	// sent anyway, even if the bulk request is not full
+	DefaultBulkFlushInterval = 5 * time.Second
+
+	// DefaultBulkWorkers is the number of concurrent bulk requests
+	DefaultBulkWorkers = 2
+
+	// DefaultMaxFailures is the number of failed bookmarks tolerated
+	// before aborting an Index run
+	DefaultMaxFailures = 10
+
+	// DefaultKeepAborted decides if an aborted index is kept (and marked
+	// with the AbortedAliasName) or deleted
+	DefaultKeepAborted = false
+
+	// DefaultTimeout bounds every request to the cluster (searches, alias
+	// switches...)
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultIndexTimeout bounds a whole Index, Reindex or Sync run (zero
+	// means no limit: they end when done, or canceled)
+	DefaultIndexTimeout = time.Duration(0)
 )
 
 // ClientOptionFunc is a function that configures a Client.
@@ -268,19 +427,37 @@ type ClientOptionFunc func(*Client) error
 // Client is the ElasticBook wrapper to an Elastic Client
 // The "elastic" package is really inspiring!
 type Client struct {
-	client  *elastic.Client
-	remote  bool
-	url     string
-	verbose bool
+	client            *elastic.Client
+	remote            bool
+	url               string
+	verbose           bool
+	bulkActions       int
+	bulkFlushInterval time.Duration
+	bulkWorkers       int
+	maxFailures       int
+	keepAborted       bool
+	timeout           time.Duration
+	indexTimeout      time.Duration
+	indexPrefix       string
+	aliasName         string
 }
 
 // NewClient Set up the default client
 func NewClient(options ...ClientOptionFunc) (*Client, error) {
 	c := &Client{
 		// client:  client(false),
-		remote:  DefaultRemote,
-		url:     DefaultURL,
-		verbose: DefaultVerbose,
+		remote:            DefaultRemote,
+		url:               DefaultURL,
+		verbose:           DefaultVerbose,
+		bulkActions:       DefaultBulkActions,
+		bulkFlushInterval: DefaultBulkFlushInterval,
+		bulkWorkers:       DefaultBulkWorkers,
+		maxFailures:       DefaultMaxFailures,
+		keepAborted:       DefaultKeepAborted,
+		timeout:           DefaultTimeout,
+		indexTimeout:      DefaultIndexTimeout,
+		indexPrefix:       DefaultIndexName,
+		aliasName:         DefaultAliasName,
 	}
 	for _, option := range options {
 		if err := option(c); err != nil {
@@ -297,7 +474,11 @@ func SetElasticClient(elasticClient *elastic.Client) ClientOptionFunc {
 			c.client = elasticClient
 			c.remote = true
 		} else {
-			c.client = client(false)
+			clnt, err := client(false)
+			if err != nil {
+				return err
+			}
+			c.client = clnt
 			c.remote = false
 		}
 		return nil
@@ -324,6 +505,125 @@ func SetURL(u string) ClientOptionFunc {
 	}
 }
 
+// SetBulkActions define how many bookmarks are sent in a bulk request
+func SetBulkActions(n int) ClientOptionFunc {
+	return func(c *Client) error {
+		if n > 0 {
+			c.bulkActions = n
+		} else {
+			c.bulkActions = DefaultBulkActions
+		}
+		return nil
+	}
+}
+
+// SetBulkFlushInterval define how often the pending bulk requests are
+// sent
+func SetBulkFlushInterval(d time.Duration) ClientOptionFunc {
+	return func(c *Client) error {
+		if d > 0 {
+			c.bulkFlushInterval = d
+		} else {
+			c.bulkFlushInterval = DefaultBulkFlushInterval
+		}
+		return nil
+	}
+}
+
+// SetBulkWorkers define how many bulk requests are sent concurrently
+func SetBulkWorkers(n int) ClientOptionFunc {
+	return func(c *Client) error {
+		if n > 0 {
+			c.bulkWorkers = n
+		} else {
+			c.bulkWorkers = DefaultBulkWorkers
+		}
+		return nil
+	}
+}
+
+// SetMaxFailures define how many failed bookmarks are tolerated before
+// aborting an Index run (a negative value means "never abort")
+func SetMaxFailures(n int) ClientOptionFunc {
+	return func(c *Client) error {
+		c.maxFailures = n
+		return nil
+	}
+}
+
+// SetKeepAborted define if an aborted index is kept, marked with the
+// AbortedAliasName, instead of being deleted
+func SetKeepAborted(keep bool) ClientOptionFunc {
+	return func(c *Client) error {
+		c.keepAborted = keep
+		return nil
+	}
+}
+
+// SetTimeout define how long a request to the cluster may take, unless
+// the context given has a deadline already (zero means no limit)
+func SetTimeout(d time.Duration) ClientOptionFunc {
+	return func(c *Client) error {
+		c.timeout = d
+		return nil
+	}
+}
+
+// SetIndexTimeout define how long an Index, Reindex or Sync run (or a
+// Scan) may take (zero means no limit)
+func SetIndexTimeout(d time.Duration) ClientOptionFunc {
+	return func(c *Client) error {
+		c.indexTimeout = d
+		return nil
+	}
+}
+
+// withTimeout bounds ctx with the timeout d, if it has no deadline yet
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// cleanupContext is used by the requests that restore a known state
+// after a failure or a cancellation: they must run even if the context
+// of the operation is done
+func (c *Client) cleanupContext() (context.Context, context.CancelFunc) {
+	return withTimeout(context.Background(), c.timeout)
+}
+
+// SetIndexPrefix define the prefix of the timestamped index names
+// (DefaultIndexName if empty)
+func SetIndexPrefix(prefix string) ClientOptionFunc {
+	return func(c *Client) error {
+		if prefix != "" {
+			c.indexPrefix = prefix
+		} else {
+			c.indexPrefix = DefaultIndexName
+		}
+		return nil
+	}
+}
+
+// SetAliasName define the alias used in Searches (DefaultAliasName if
+// empty)
+func SetAliasName(name string) ClientOptionFunc {
+	return func(c *Client) error {
+		if name != "" {
+			c.aliasName = name
+		} else {
+			c.aliasName = DefaultAliasName
+		}
+		return nil
+	}
+}
+
+// AliasName returns the alias used in Searches
+func (c *Client) AliasName() string {
+	return c.aliasName
+}
+
 // ClientLocal connects to a local ES cluster
 func ClientLocal() (*Client, error) {
 	return NewClient(
@@ -334,44 +634,66 @@ func ClientLocal() (*Client, error) {
 // Debug with this:
 //   /_nodes/http?pretty=1
 // https://github.com/olivere/elastic/wiki/Connection-Problems
-func ClientRemote() (*Client, error) {
-	return NewClient(
+//
+// Further options are applied after the default ones.
+func ClientRemote(options ...ClientOptionFunc) (*Client, error) {
+	clnt, err := client(true)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(append([]ClientOptionFunc{
 		SetVerbose(false),
 		SetURL(os.Getenv("BONSAIO_HOST")),
-		SetElasticClient(client(true)))
+		SetElasticClient(clnt)}, options...)...)
 }
 
-// Alias creates an alias.
+// Alias is AliasContext with a background context
+func (c *Client) Alias(indexName string, aliasName string) (bool, error) {
+	return c.AliasContext(context.Background(), indexName, aliasName)
+}
+
+// AliasContext creates an alias.
 // It's enforced a constraint though: "No more than one index per alias"
 // This means that, if the alias already exists, this method returns
-// false.
-func (c *Client) Alias(indexName string, aliasName string) (bool, error) {
-	existingAliases, err := c.AliasNames()
+// false and ErrAliasConflict.
+func (c *Client) AliasContext(ctx context.Context, indexName string, aliasName string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
+	existingAliases, err := c.AliasNamesContext(ctx)
 	if err != nil {
 		return false, err
 	}
 
 	if utils.ContainsString(existingAliases, aliasName) {
-		return false, nil
+		return false, fmt.Errorf("%w: %s already exists", ErrAliasConflict, aliasName)
 	}
 
 	client := c.client
-	ack, err := client.Alias().Add(indexName, aliasName).Do()
+	ack, err := client.Alias().Add(indexName, aliasName).DoC(ctx)
 	if err != nil {
-		return false, err
+		return false, wrapError(err)
 	}
 	return ack.Acknowledged, nil
 }
 
-// AliasNames returns the list of existing aliases (just the names,
+// AliasNames is AliasNamesContext with a background context
+func (c *Client) AliasNames() ([]string, error) {
+	return c.AliasNamesContext(context.Background())
+}
+
+// AliasNamesContext returns the list of existing aliases (just the names,
 // sorted).
 // Due to the constraint enforced by Client#Alias this slice should not
 // contains dupes (^_^)
-func (c *Client) AliasNames() ([]string, error) {
+func (c *Client) AliasNamesContext(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
 	client := c.client
-	info, err := client.Aliases().Index("_all").Do()
+	info, err := client.Aliases().Index("_all").DoC(ctx)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 
 	ins := info.Indices
@@ -386,12 +708,20 @@ func (c *Client) AliasNames() ([]string, error) {
 	return aliasNames, nil
 }
 
-// Aliases returns the list of existing aliases
+// Aliases is AliasesContext with a background context
 func (c *Client) Aliases() ([]string, error) {
+	return c.AliasesContext(context.Background())
+}
+
+// AliasesContext returns the list of existing aliases
+func (c *Client) AliasesContext(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
 	client := c.client
-	info, err := client.Aliases().Index("_all").Do()
+	info, err := client.Aliases().Index("_all").DoC(ctx)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 
 	ins := info.Indices
@@ -403,9 +733,9 @@ func (c *Client) Aliases() ([]string, error) {
 			vs = append(vs, x.AliasName)
 		}
 
-		c, err := client.Count(k).Do()
+		c, err := client.Count(k).DoC(ctx)
 		if err != nil {
-			return nil, err
+			return nil, wrapError(err)
 		}
 
 		kv := fmt.Sprintf("%s (%d): \t\t[%s]", k, c, strings.Join(vs, ", "))
@@ -417,75 +747,98 @@ func (c *Client) Aliases() ([]string, error) {
 	return names, nil
 }
 
-// Default switch the default alias to the given index name (if it
+// Default is DefaultContext with a background context
+func (c *Client) Default(indexName string) (bool, error) {
+	return c.DefaultContext(context.Background(), indexName)
+}
+
+// DefaultContext switch the default alias to the given index name (if it
 // exists).
+// The alias is removed from the other indices and added to the new one
+// in a single (atomic) request, so Searches never miss it.
 // Returns true if the switch is successful.
-func (c *Client) Default(indexName string) (bool, error) {
+func (c *Client) DefaultContext(ctx context.Context, indexName string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
 	client := c.client
 
-	ia, err := c.indexAliases()
+	ia, err := c.indexAliases(ctx)
 	if err != nil {
 		return false, err
 	}
 
 	if _, ok := ia[indexName]; !ok {
-		err := fmt.Errorf("Index %s does not exists", indexName)
-		return false, err
+		return false, fmt.Errorf("%w: %s", ErrIndexNotFound, indexName)
 	}
 
 	aliasService := client.Alias()
 	for k, vs := range ia {
-		if utils.ContainsString(vs, DefaultAliasName) {
-			_, err := aliasService.Remove(k, DefaultAliasName).Do()
-			if err != nil {
-				return false, err
-			}
+		if k != indexName && utils.ContainsString(vs, c.aliasName) {
+			aliasService.Remove(k, c.aliasName)
 		}
 	}
 
-	ack, err := aliasService.Add(indexName, DefaultAliasName).Do()
+	ack, err := aliasService.Add(indexName, c.aliasName).DoC(ctx)
 	if err != nil {
-		return false, err
+		return false, wrapError(err)
 	}
 
 	return ack.Acknowledged, nil
 }
 
-// Delete drops the index
-func (c *Client) Delete(indexName string) {
+// Delete is DeleteContext with a background context
+func (c *Client) Delete(indexName string) error {
+	return c.DeleteContext(context.Background(), indexName)
+}
+
+// DeleteContext drops the index
+func (c *Client) DeleteContext(ctx context.Context, indexName string) error {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
 	client := c.client
 
-	r, err := client.DeleteIndex(indexName).Do()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
-	}
-	fmt.Fprintf(os.Stdout, "%+v\n", r)
+	_, err := client.DeleteIndex(indexName).DoC(ctx)
+	return wrapError(err)
 }
 
-// Doctor adds the Default alias to an index
-func (c *Client) Doctor() {
+// Health is HealthContext with a background context
+func (c *Client) Health() (*elastic.ClusterHealthResponse, error) {
+	return c.HealthContext(context.Background())
 }
 
-// Health check the status of the cluster
-func (c *Client) Health() (*elastic.ClusterHealthResponse, error) {
+// HealthContext check the status of the cluster
+func (c *Client) HealthContext(ctx context.Context) (*elastic.ClusterHealthResponse, error) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
 	cl := c.client
-	return cl.ClusterHealth().Do()
+	h, err := cl.ClusterHealth().DoC(ctx)
+	return h, wrapError(err)
 }
 
-// Indices returns the list of existing indices
+// Indices is IndicesContext with a background context
 func (c *Client) Indices() ([]string, error) {
+	return c.IndicesContext(context.Background())
+}
+
+// IndicesContext returns the list of existing indices
+func (c *Client) IndicesContext(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
 	client := c.client
-	ins, err := client.IndexNames()
+	ins, err := c.indexNames(ctx)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 
 	names := make([]string, len(ins))
 	for i, n := range ins {
-		c, err := client.Count(n).Do()
+		c, err := client.Count(n).DoC(ctx)
 		if err != nil {
-			return names, err
+			return names, wrapError(err)
 		}
 		names[i] = fmt.Sprintf("%s (%d)", n, c)
 	}
@@ -494,86 +847,110 @@ func (c *Client) Indices() ([]string, error) {
 	return names, nil
 }
 
-// Mappings returns the current index mapping
+// Mappings is MappingsContext with a background context
 func (c *Client) Mappings() (map[string]interface{}, error) {
+	return c.MappingsContext(context.Background())
+}
+
+// MappingsContext returns the current index mapping
+func (c *Client) MappingsContext(ctx context.Context) (map[string]interface{}, error) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
 	client := c.client
 	ms := client.GetMapping()
-	mappings, err := ms.Index(DefaultAliasName).Pretty(true).Do()
+	mappings, err := ms.Index(c.aliasName).Pretty(true).DoC(ctx)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	return mappings, nil
 }
 
-// IndexNames returns the list of existing indices (just the names)
+// IndexNames is IndexNamesContext with a background context
 func (c *Client) IndexNames() ([]string, error) {
-	client := c.client
-	ins, err := client.IndexNames()
+	return c.IndexNamesContext(context.Background())
+}
+
+// IndexNamesContext returns the list of existing indices (just the names)
+func (c *Client) IndexNamesContext(ctx context.Context) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
+	ins, err := c.indexNames(ctx)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 
 	sort.Strings(ins)
 	return ins, nil
 }
 
-// Index takes a parsed structure and index all the Bookmarks entries
-func (c *Client) Index(x *Root) (bool, error) {
+// Index is IndexContext with a background context
+func (c *Client) Index(ss ...*Source) (*IndexReport, error) {
+	return c.IndexContext(context.Background(), ss...)
+}
+
+// IndexContext takes some parsed structures (e.g. one per browser profile) and
+// index all the Bookmarks entries in a brand new index, using the bulk
+// API.
+// If more bookmarks than the max allowed fail, the run is aborted: the
+// partial index is deleted (or marked, see SetKeepAborted) and the
+// report is returned along with ErrIndexAborted.
+// The same happens if ctx is done (e.g. canceled on Ctrl-C): no more
+// bookmarks are sent, the pending bulk requests are flushed and the
+// partial index is discarded, then ctx.Err() is returned.
+// Any other failure once the index is created (flushing the bulk
+// requests, storing the checksum) discards it as well: the cluster is
+// never left with an index half built.
+func (c *Client) IndexContext(ctx context.Context, ss ...*Source) (*IndexReport, error) {
+	ctx, cancel := withTimeout(ctx, c.indexTimeout)
+	defer cancel()
+
 	client := c.client
 
 	indexName := c.newIndexName()
-	if exists, _ := client.IndexExists(indexName).Do(); !exists {
-		_, err := client.CreateIndex(indexName).Do()
+	exists, err := client.IndexExists(indexName).DoC(ctx)
+	if err != nil {
+		// Nothing created yet: nothing to discard
+		return nil, wrapError(err)
+	}
+	if !exists {
+		_, err := client.CreateIndex(indexName).Body(defaultSettings).DoC(ctx)
 		if err != nil {
-			return false, err
+			return nil, wrapError(err)
 		}
 	}
 
-	c.putDefaultMapping(indexName)
+	report := &IndexReport{IndexName: indexName}
+
+	// abort discards the partial index, with a context of its own as ctx
+	// may be done already
+	abort := func(err error) (*IndexReport, error) {
+		dctx, dcancel := c.cleanupContext()
+		defer dcancel()
+		if derr := c.discard(dctx, indexName); derr != nil {
+			return report, derr
+		}
+		return report, err
+	}
+
+	if err := c.putDefaultMapping(ctx, indexName); err != nil {
+		return abort(err)
+	}
 
-	ins, err := client.IndexNames()
+	ins, err := c.indexNames(ctx)
 	if err != nil {
-		return false, err
+		return abort(wrapError(err))
 	}
 
 	if len(ins) == 1 {
-		_, err := client.Alias().Add(indexName, DefaultIndexName).Do()
+		_, err := client.Alias().Add(indexName, c.indexPrefix).DoC(ctx)
 		if err != nil {
-			return false, err
+			return abort(wrapError(err))
 		}
 	}
 
-	var wg sync.WaitGroup
-	var workForce = 5
-	ch := make(chan Bookmark, workForce)
-
-	for i := 0; i < workForce; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			var b Bookmark
-			var more bool
-
-			for {
-				b, more = <-ch
-				if !more {
-					return
-				}
-				_, err := client.Index().
-					Index(indexName).
-					Type(TypeName).
-					BodyJson(b.toIndexable()).
-					Do()
-				if err != nil {
-					// TODO: Handle error
-					fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-					panic(err)
-				}
-			}
-		}()
-	}
-
-	count := x.Count().Total()
+	count := sourcesTotal(ss)
 	bar := uiprogress.AddBar(count)
 	bar.AppendCompleted()
 	bar.PrependElapsed()
@@ -581,92 +958,256 @@ func (c *Client) Index(x *Root) (bool, error) {
 		return fmt.Sprintf("Node (%d/%d)", b.Current(), count)
 	})
 
+	var mu sync.Mutex
+
+	p, err := client.BulkProcessor().
+		Name("elasticbook-indexer").
+		Workers(c.bulkWorkers).
+		BulkActions(c.bulkActions).
+		FlushInterval(c.bulkFlushInterval).
+		After(func(_ int64, rs []elastic.BulkableRequest, r *elastic.BulkResponse, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			report.collect(rs, r, err)
+			report.Aborted = report.exceeds(c.maxFailures)
+			for range rs {
+				bar.Incr()
+			}
+		}).
+		Do()
+	if err != nil {
+		return abort(err)
+	}
+
 	uiprogress.Start()
-	for _, x := range x.Roots.BookmarkBar.Children {
-		ch <- x
-		bar.Incr()
+	for _, s := range ss {
+		s.Walk(func(b *Bookmark, l Location) {
+			mu.Lock()
+			aborted := report.Aborted
+			mu.Unlock()
+			if aborted || ctx.Err() != nil {
+				return
+			}
+			bs, err := b.toIndexable(l)
+			if err != nil {
+				mu.Lock()
+				report.Failed = append(report.Failed, IndexFailure{ID: s.ID(b), Reason: err.Error()})
+				report.Aborted = report.exceeds(c.maxFailures)
+				mu.Unlock()
+				bar.Incr()
+				return
+			}
+			p.Add(elastic.NewBulkIndexRequest().
+				Index(indexName).
+				Type(TypeName).
+				Id(s.ID(b)).
+				Doc(bs))
+		})
+	}
+
+	// Close flushes the pending requests and waits for the workers
+	err = p.Close()
+	uiprogress.Stop()
+	if err != nil {
+		return abort(wrapError(err))
 	}
-	for _, x := range x.Roots.Synced.Children {
-		ch <- x
-		bar.Incr()
+
+	if err := ctx.Err(); err != nil {
+		return abort(err)
 	}
-	for _, x := range x.Roots.Other.Children {
-		ch <- x
-		bar.Incr()
+	if report.Aborted {
+		return abort(ErrIndexAborted)
 	}
 
-	uiprogress.Stop()
-	close(ch)
-	wg.Wait()
+	if err := c.putChecksum(ctx, indexName, sourcesChecksum(ss)); err != nil {
+		return abort(wrapError(err))
+	}
+	return report, nil
+}
 
-	return true, nil
+// discard gets rid of an aborted index: it is deleted, or marked with
+// the AbortedAliasName if the Client has been told to keep it
+func (c *Client) discard(ctx context.Context, indexName string) error {
+	client := c.client
+	if c.keepAborted {
+		_, err := client.Alias().Add(indexName, AbortedAliasName).DoC(ctx)
+		return err
+	}
+	_, err := client.DeleteIndex(indexName).DoC(ctx)
+	return err
 }
 
-// Parse run the JSON parser
+// Parse run the JSON parser (see Parse)
 func (c *Client) Parse(b []byte) (*Root, error) {
+	return Parse(b)
+}
+
+// Parse run the JSON parser. The checksum is verified: if it does not
+// match, the tree is returned with ErrChecksumMismatch.
+func Parse(b []byte) (*Root, error) {
 	x := new(Root)
 	err := json.Unmarshal(b, &x)
-	return x, err
+	if err != nil {
+		return x, err
+	}
+	return x, x.Verify()
+}
+
+// SearchOptions restricts a search (the empty values mean "everywhere")
+type SearchOptions struct {
+	// Folder is a folder subtree, like "Bookmarks Bar/Work" (joined with
+	// the PathSeparator, see Location.Folder)
+	Folder string
+	// Browser and Profile select the Source of the bookmarks
+	Browser string
+	Profile string
+	// After and Before bound the date_added of the bookmarks (After is
+	// included, Before is not; the zero Time means no bound). See
+	// ParseDate.
+	After  time.Time
+	Before time.Time
+	// Slop is the slop of the quoted phrases without one (see Phrase)
+	Slop int
+	// Sort is the order of the hits: SortRelevance by default
+	Sort Sort
+
+	// Page (counted from 1) and Size select a page of the hits: the
+	// first DefaultPageSize ones by default
+	Page int
+	Size int
+	// Cursor continues the search from another page (see
+	// SearchResult.Next): it overrides Page and Size
+	Cursor string
 }
 
 // Search is the API for searching
-func (c *Client) Search(term string) (*elastic.SearchResult, error) {
+func (c *Client) Search(term string) (*SearchResult, error) {
+	return c.SearchWith(term, SearchOptions{})
+}
+
+// SearchWith is SearchWithContext with a background context
+func (c *Client) SearchWith(term string, o SearchOptions) (*SearchResult, error) {
+	return c.SearchWithContext(context.Background(), term, o)
+}
+
+// SearchWithContext looks for bookmarks, restricted by the options, and
+// returns a page of them (see Pager). The term is parsed with ParseQuery:
+// its operators override the options. The scores are tracked whatever
+// the sort.
+func (c *Client) SearchWithContext(ctx context.Context, term string, o SearchOptions) (*SearchResult, error) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
 	client := c.client
 
-	q := elastic.NewMultiMatchQuery(term, DefaultFields...).
-		ZeroTermsQuery("none").
-		QueryName("elasticbookSearch").
-		PrefixLength(2).
-		Fuzziness("AUTO").
-		Type("most_fields").
-		FieldWithBoost("name", float64(2))
+	pq, err := ParseQuery(term)
+	if err != nil {
+		return nil, err
+	}
+	q := pq.boolQuery(o)
+
+	pg, err := NewPager(term, o)
+	if err != nil {
+		return nil, err
+	}
+	if pg.Index == "" {
+		// The index holding the alias, so that the next pages stay on it
+		// (the alias itself if it is not on a single index)
+		if pg.Index, err = c.defaultIndex(ctx); err != nil {
+			pg.Index = c.aliasName
+		}
+	}
 
-	sr, err := client.Search().
-		Index(DefaultAliasName).
+	esr, err := client.Search().
+		Index(pg.Index).
 		Type(TypeName).
 		Query(q).
 		Explain(true).
-		// No '_score' field is returned if this is enabled
-		// Sort("date_added", true).
-		From(0).
-		Size(100).
+		SortBy(sorters(pg.Sort)...).
+		TrackScores(true).
+		From(pg.From).
+		Size(pg.Size).
 		Pretty(true).
-		Do()
+		DoC(ctx)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	sr, err := newSearchResult(esr)
+	if err != nil {
+		return nil, err
+	}
+	pg.Finish(sr)
+	return sr, nil
+}
 
-	return sr, err
+// sorters returns the Elasticsearch sort of an order (see sortKey)
+func sorters(s Sort) []elastic.Sorter {
+	var ss []elastic.Sorter
+	switch s {
+	case SortRelevance:
+		ss = append(ss, elastic.NewScoreSort().Desc(), elastic.NewFieldSort("date_added").Desc())
+	case SortNewest:
+		ss = append(ss, elastic.NewFieldSort("date_added").Desc())
+	case SortOldest:
+		ss = append(ss, elastic.NewFieldSort("date_added").Asc())
+	case SortTitle:
+		ss = append(ss, elastic.NewFieldSort("name.sort").Asc())
+	case SortDomain:
+		ss = append(ss, elastic.NewFieldSort("domain").Asc().Missing("_last"), elastic.NewFieldSort("name.sort").Asc())
+	}
+	return append(ss, elastic.NewFieldSort("_uid").Asc())
 }
 
-// Suggest performs a _suggest query
-func (c *Client) Suggest(term string) (elastic.SuggestResult, error) {
-	client := c.client
-	nameSuggest := "name_suggest"
+// Suggest is SuggestContext with a background context
+func (c *Client) Suggest(term string) ([]string, error) {
+	return c.SuggestContext(context.Background(), term)
+}
 
-	termSuggesterName := "elasticbook-term-suggester"
-	termSuggester := elastic.NewTermSuggester(
-		termSuggesterName).Text(term).Field(nameSuggest)
+// SuggestContext performs a _suggest query (completion suggester) and returns
+// the bookmark names found
+func (c *Client) SuggestContext(ctx context.Context, term string) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
 
-	phraseSuggesterName := "elasticbook-phrase-suggester"
-	phraseSuggester := elastic.NewPhraseSuggester(
-		phraseSuggesterName).Text(term).Field(nameSuggest)
+	client := c.client
+	nameSuggest := "name_suggest"
 
 	completionSuggesterName := "elasticbook-completion-suggester"
 	completionSuggester := elastic.NewCompletionSuggester(
 		completionSuggesterName).Text(term).Field(nameSuggest)
 
-	return client.Suggest().
-		Index(DefaultAliasName).
-		Suggester(termSuggester).
-		Suggester(phraseSuggester).
+	sr, err := client.Suggest().
+		Index(c.aliasName).
 		Suggester(completionSuggester).
-		Do()
+		DoC(ctx)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	var names []string
+	for _, s := range sr[completionSuggesterName] {
+		for _, o := range s.Options {
+			names = append(names, o.Text)
+		}
+	}
+	return names, nil
 }
 
-// Unalias deletes an alias
+// Unalias is UnaliasContext with a background context
 func (c *Client) Unalias(aliasName string) (bool, error) {
+	return c.UnaliasContext(context.Background(), aliasName)
+}
+
+// UnaliasContext deletes an alias
+func (c *Client) UnaliasContext(ctx context.Context, aliasName string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
 	client := c.client
-	info, err := client.Aliases().Index("_all").Do()
+	info, err := client.Aliases().Index("_all").DoC(ctx)
 	if err != nil {
-		return false, err
+		return false, wrapError(err)
 	}
 
 	indexAliases := make(map[string][]string)
@@ -682,9 +1223,9 @@ func (c *Client) Unalias(aliasName string) (bool, error) {
 	aliasService := client.Alias()
 	for k, vs := range indexAliases {
 		if utils.ContainsString(vs, aliasName) {
-			_, err := aliasService.Remove(k, aliasName).Do()
+			_, err := aliasService.Remove(k, aliasName).DoC(ctx)
 			if err != nil {
-				return false, err
+				return false, wrapError(err)
 			}
 		}
 	}
@@ -697,26 +1238,48 @@ func (c *Client) URL() string {
 	return c.url
 }
 
-// Version check the version of the cluster
-func (c *Client) Version() string {
+// Version is VersionContext with a background context
+func (c *Client) Version() (string, error) {
+	return c.VersionContext(context.Background())
+}
+
+// VersionContext check the version of the cluster
+func (c *Client) VersionContext(ctx context.Context) (string, error) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
 	client := c.client
-	esversion, err := client.ElasticsearchVersion(c.url)
+	res, _, err := client.Ping(c.url).DoC(ctx)
 	if err != nil {
-		fmt.Fprintf(
-			os.Stderr,
-			"Unable to detect ES cluster version: (%s) %s ", c.url, err.Error())
-		os.Exit(1)
+		return "", wrapError(err)
+	}
+	if res.Version.Number == "" {
+		return "", fmt.Errorf("Unable to detect ES cluster version (%s)", c.url)
 	}
 
-	return esversion
+	return res.Version.Number, nil
 }
 
-func (c *Client) indexAliases() (map[string][]string, error) {
-	client := c.client
-	info, err := client.Aliases().Index("_all").Do()
+// indexNames returns the names of all the indices (like
+// elastic.Client.IndexNames, but honouring ctx)
+func (c *Client) indexNames(ctx context.Context) ([]string, error) {
+	res, err := c.client.IndexGetSettings("_all").DoC(ctx)
 	if err != nil {
 		return nil, err
 	}
+	var names []string
+	for name := range res {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (c *Client) indexAliases(ctx context.Context) (map[string][]string, error) {
+	client := c.client
+	info, err := client.Aliases().Index("_all").DoC(ctx)
+	if err != nil {
+		return nil, wrapError(err)
+	}
 
 	ia := make(map[string][]string)
 
@@ -732,13 +1295,55 @@ func (c *Client) indexAliases() (map[string][]string, error) {
 }
 
 func (c *Client) newIndexName() string {
-	t := time.Now().UTC()
-	s := fmt.Sprintf("%d%02d%02d%02d%02d%02d",
-		t.Year(), t.Month(), t.Day(),
-		t.Hour(), t.Minute(), t.Second())
-	return fmt.Sprintf("%s-%s", DefaultIndexName, s)
+	return newIndexName(c.indexPrefix)
 }
 
+// defaultSettings declares the "folder_path" analyzer: each folder is
+// indexed along with all its ancestors ("Bookmarks Bar",
+// "Bookmarks Bar/Work", "Bookmarks Bar/Work/Go") so that a term filter
+// on "folder" selects a whole subtree. The "/" inside the folder names
+// are escaped (see EscapeFolderName).
+// The "name_shingles" analyzer indexes the pairs and triples of adjacent
+// words of the names ("go by", "by example", "go by example"): a search
+// for several words ranks higher the names having them together.
+// The "sortable" analyzer keeps a name whole, lowercased, to sort by it.
+const defaultSettings = `{
+	"settings" : {
+		"analysis" : {
+			"analyzer" : {
+				"folder_path" : {
+					"type" : "custom",
+					"tokenizer" : "folder_path"
+				},
+				"name_shingles" : {
+					"type" : "custom",
+					"tokenizer" : "standard",
+					"filter" : ["lowercase", "name_shingles"]
+				},
+				"sortable" : {
+					"type" : "custom",
+					"tokenizer" : "keyword",
+					"filter" : ["lowercase"]
+				}
+			},
+			"filter" : {
+				"name_shingles" : {
+					"type" : "shingle",
+					"min_shingle_size" : 2,
+					"max_shingle_size" : 3,
+					"output_unigrams" : false
+				}
+			},
+			"tokenizer" : {
+				"folder_path" : {
+					"type" : "path_hierarchy",
+					"delimiter" : "/"
+				}
+			}
+		}
+	}
+}`
+
 // Notice the differences between 1.7 and 2.1:
 // ## 1.7
 // https://www.elastic.co/guide/en/elasticsearch/reference/1.7/search-suggesters-completion.html
@@ -751,7 +1356,7 @@ func (c *Client) newIndexName() string {
 //   "search_analyzer": "simple",
 //   "payloads": false
 // },
-func (c *Client) putDefaultMapping(indexName string) bool {
+func (c *Client) putDefaultMapping(ctx context.Context, indexName string) error {
 	mappings := `{
 		"bookmark" : {
       "properties" : {
@@ -759,9 +1364,32 @@ func (c *Client) putDefaultMapping(indexName string) bool {
           "type" : "date",
           "format" : "dateOptionalTime"
         },
+        "date_modified" : {
+          "type" : "string",
+          "index" : "not_analyzed"
+        },
+        "domain" : {
+          "type" : "string",
+          "index" : "not_analyzed"
+        },
+        "folder" : {
+          "type" : "string",
+          "analyzer" : "folder_path",
+          "search_analyzer" : "keyword",
+          "fields" : {
+            "raw" : {
+              "type" : "string",
+              "index" : "not_analyzed"
+            }
+          }
+        },
         "id" : {
           "type" : "string"
         },
+        "keyword" : {
+          "type" : "string",
+          "index" : "not_analyzed"
+        },
         "meta_info" : {
           "properties" : {
             "stars_id" : {
@@ -782,7 +1410,17 @@ func (c *Client) putDefaultMapping(indexName string) bool {
           }
         },
         "name" : {
-          "type" : "string"
+          "type" : "string",
+          "fields" : {
+            "shingles" : {
+              "type" : "string",
+              "analyzer" : "name_shingles"
+            },
+            "sort" : {
+              "type" : "string",
+              "analyzer" : "sortable"
+            }
+          }
         },
 				"name_suggest": {
                "type": "completion",
@@ -790,9 +1428,39 @@ func (c *Client) putDefaultMapping(indexName string) bool {
                "search_analyzer": "simple",
                "payloads": false
         },
+        "path" : {
+          "type" : "string",
+          "index" : "not_analyzed",
+          "fields" : {
+            "text" : {
+              "type" : "string"
+            }
+          }
+        },
+        "root" : {
+          "type" : "string",
+          "index" : "not_analyzed"
+        },
+        "source_browser" : {
+          "type" : "string",
+          "index" : "not_analyzed"
+        },
+        "source_profile" : {
+          "type" : "string",
+          "index" : "not_analyzed"
+        },
         "sync_transaction_version" : {
           "type" : "string"
         },
+        "tags" : {
+          "type" : "string",
+          "index" : "not_analyzed",
+          "fields" : {
+            "text" : {
+              "type" : "string"
+            }
+          }
+        },
         "type" : {
           "type" : "string"
         },
@@ -809,21 +1477,15 @@ func (c *Client) putDefaultMapping(indexName string) bool {
 		Index(indexName).
 		Type(TypeName).
 		BodyString(mappings).
-		Do()
+		DoC(ctx)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "expected put mapping to succeed; got: %v", err)
-		return false
+		return wrapError(err)
 	}
-	if putresp == nil {
-		fmt.Fprintf(os.Stderr, "expected put mapping response; got: %v", putresp)
-		return false
-	}
-	if !putresp.Acknowledged {
-		fmt.Fprintf(os.Stderr, "expected put mapping ack; got: %v", putresp.Acknowledged)
-		return false
+	if putresp == nil || !putresp.Acknowledged {
+		return fmt.Errorf("put mapping of %s not acknowledged", indexName)
 	}
 
-	return true
+	return nil
 }
 
 func stripchars(str, chr string) string {
@@ -842,12 +1504,11 @@ func stripchars(str, chr string) string {
 // Quoting:
 // From MSDN, FILETIME "Contains a 64-bit value representing the number of
 // 100-nanosecond intervals since January 1, 1601 (UTC)."
-func timeParse(microsecs string) time.Time {
+func timeParse(microsecs string) (time.Time, error) {
 	t := time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
 	m, err := strconv.ParseInt(microsecs, 10, 64)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return t, fmt.Errorf("%w: %q", ErrUnparseableDate, microsecs)
 	}
 	var u int64 = 100000000000000
 	du := time.Duration(u) * time.Microsecond
@@ -866,5 +1527,5 @@ func timeParse(microsecs string) time.Time {
 
 	// RFC1123 = "Mon, 02 Jan 2006 15:04:05 MST"
 	// t.Format(time.RFC1123)
-	return t
+	return t, nil
 }
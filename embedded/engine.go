@@ -0,0 +1,393 @@
+// Package embedded is an elasticbook Backend living on the local disk (a
+// Bleve index per elasticbook index): no cluster needed.
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/blevesearch/bleve"
+	"github.com/zeroed/elasticbook"
+)
+
+// BackendName is the name of this Backend (e.g. for a --backend flag)
+const BackendName = "embedded"
+
+// DataDirEnv is the environment variable overriding the DefaultDir
+const DataDirEnv = "ELASTICBOOK_DATA"
+
+// The layout of the data directory: the indices in a sub-directory,
+// the aliases in a JSON file (alias name -> index name)
+const (
+	indicesDir  = "indices"
+	aliasesFile = "aliases.json"
+)
+
+// DefaultDir returns $ELASTICBOOK_DATA, or ~/.elasticbook
+func DefaultDir() string {
+	if d := os.Getenv(DataDirEnv); d != "" {
+		return d
+	}
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = os.Getenv("USERPROFILE")
+	}
+	return filepath.Join(home, ".elasticbook")
+}
+
+// Engine is the embedded Backend. An index can be opened by a single
+// process at a time: Close the Engine when done.
+type Engine struct {
+	dir     string
+	mu      sync.Mutex
+	indices map[string]bleve.Index
+
+	batchSize   int
+	maxFailures int
+	keepAborted bool
+}
+
+// Engine is an elasticbook Backend
+var _ elasticbook.Backend = (*Engine)(nil)
+
+// OptionFunc is a function that configures an Engine (see Open)
+type OptionFunc func(*Engine) error
+
+// Open returns an Engine storing its data in dir (created if needed)
+func Open(dir string, options ...OptionFunc) (*Engine, error) {
+	e := &Engine{
+		dir:         dir,
+		indices:     make(map[string]bleve.Index),
+		batchSize:   elasticbook.DefaultBulkActions,
+		maxFailures: elasticbook.DefaultMaxFailures,
+	}
+	for _, option := range options {
+		if err := option(e); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, indicesDir), 0700); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetBatchSize define how many bookmarks are indexed in a single batch
+// (the --bulk-actions of Elasticsearch)
+func SetBatchSize(n int) OptionFunc {
+	return func(e *Engine) error {
+		if n > 0 {
+			e.batchSize = n
+		} else {
+			e.batchSize = elasticbook.DefaultBulkActions
+		}
+		return nil
+	}
+}
+
+// SetMaxFailures define how many bookmarks may fail before an Index run
+// is aborted (see elasticbook.SetMaxFailures)
+func SetMaxFailures(n int) OptionFunc {
+	return func(e *Engine) error {
+		e.maxFailures = n
+		return nil
+	}
+}
+
+// SetKeepAborted define if an aborted index is kept, marked with the
+// AbortedAliasName, instead of being deleted. An alias names a single
+// index here: the last aborted one.
+func SetKeepAborted(keep bool) OptionFunc {
+	return func(e *Engine) error {
+		e.keepAborted = keep
+		return nil
+	}
+}
+
+// Close closes the indices opened so far
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var err error
+	for name, idx := range e.indices {
+		if cerr := idx.Close(); err == nil {
+			err = cerr
+		}
+		delete(e.indices, name)
+	}
+	return err
+}
+
+// URL returns the data directory
+func (e *Engine) URL() string {
+	return e.dir
+}
+
+// AliasName returns the default alias, the DefaultAliasName
+func (e *Engine) AliasName() string {
+	return elasticbook.DefaultAliasName
+}
+
+func (e *Engine) indexPath(indexName string) string {
+	return filepath.Join(e.dir, indicesDir, indexName)
+}
+
+// open returns the (cached) Bleve index
+func (e *Engine) open(indexName string) (bleve.Index, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if idx, ok := e.indices[indexName]; ok {
+		return idx, nil
+	}
+	idx, err := bleve.Open(e.indexPath(indexName))
+	if err != nil {
+		return nil, err
+	}
+	e.indices[indexName] = idx
+	return idx, nil
+}
+
+// resolve returns the index behind an alias, or the index itself
+func (e *Engine) resolve(name string) (string, error) {
+	as, err := e.aliases()
+	if err != nil {
+		return "", err
+	}
+	if indexName, ok := as[name]; ok {
+		return indexName, nil
+	}
+	if e.exists(name) {
+		return name, nil
+	}
+	return "", fmt.Errorf("%w: %s", elasticbook.ErrIndexNotFound, name)
+}
+
+func (e *Engine) exists(indexName string) bool {
+	fi, err := os.Stat(e.indexPath(indexName))
+	return err == nil && fi.IsDir()
+}
+
+func (e *Engine) count(indexName string) (uint64, error) {
+	idx, err := e.open(indexName)
+	if err != nil {
+		return 0, err
+	}
+	return idx.DocCount()
+}
+
+// aliases reads the aliases file (alias name -> index name)
+func (e *Engine) aliases() (map[string]string, error) {
+	as := make(map[string]string)
+	b, err := ioutil.ReadFile(filepath.Join(e.dir, aliasesFile))
+	if os.IsNotExist(err) {
+		return as, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return as, json.Unmarshal(b, &as)
+}
+
+func (e *Engine) putAliases(as map[string]string) error {
+	b, err := json.MarshalIndent(as, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(e.dir, aliasesFile), b, 0600)
+}
+
+// IndexNames returns the list of existing indices (just the names)
+func (e *Engine) IndexNames() ([]string, error) {
+	fis, err := ioutil.ReadDir(filepath.Join(e.dir, indicesDir))
+	if err != nil {
+		return nil, err
+	}
+	var ins []string
+	for _, fi := range fis {
+		if fi.IsDir() {
+			ins = append(ins, fi.Name())
+		}
+	}
+	sort.Strings(ins)
+	return ins, nil
+}
+
+// Indices returns the list of existing indices, with their count
+func (e *Engine) Indices() ([]string, error) {
+	ins, err := e.IndexNames()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(ins))
+	for i, n := range ins {
+		c, err := e.count(n)
+		if err != nil {
+			return names, err
+		}
+		names[i] = fmt.Sprintf("%s (%d)", n, c)
+	}
+	return names, nil
+}
+
+// Aliases returns the list of existing indices, with their aliases
+func (e *Engine) Aliases() ([]string, error) {
+	ins, err := e.IndexNames()
+	if err != nil {
+		return nil, err
+	}
+	as, err := e.aliases()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(ins))
+	for i, n := range ins {
+		var vs []string
+		for a, x := range as {
+			if x == n {
+				vs = append(vs, a)
+			}
+		}
+		sort.Strings(vs)
+		c, err := e.count(n)
+		if err != nil {
+			return nil, err
+		}
+		names[i] = fmt.Sprintf("%s (%d): \t\t[%s]", n, c, strings.Join(vs, ", "))
+	}
+	return names, nil
+}
+
+// Alias creates an alias (false and ErrAliasConflict if it already
+// exists, see Client.Alias)
+func (e *Engine) Alias(indexName string, aliasName string) (bool, error) {
+	if !e.exists(indexName) {
+		return false, fmt.Errorf("%w: %s", elasticbook.ErrIndexNotFound, indexName)
+	}
+	as, err := e.aliases()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := as[aliasName]; ok {
+		return false, fmt.Errorf("%w: %s already exists", elasticbook.ErrAliasConflict, aliasName)
+	}
+	as[aliasName] = indexName
+	return true, e.putAliases(as)
+}
+
+// Unalias deletes an alias
+func (e *Engine) Unalias(aliasName string) (bool, error) {
+	as, err := e.aliases()
+	if err != nil {
+		return false, err
+	}
+	delete(as, aliasName)
+	return true, e.putAliases(as)
+}
+
+// Default points the default alias to the given index
+func (e *Engine) Default(indexName string) (bool, error) {
+	if !e.exists(indexName) {
+		return false, fmt.Errorf("%w: %s", elasticbook.ErrIndexNotFound, indexName)
+	}
+	as, err := e.aliases()
+	if err != nil {
+		return false, err
+	}
+	as[elasticbook.DefaultAliasName] = indexName
+	return true, e.putAliases(as)
+}
+
+// Delete drops the index, and its aliases
+func (e *Engine) Delete(indexName string) error {
+	if !e.exists(indexName) {
+		return fmt.Errorf("%w: %s", elasticbook.ErrIndexNotFound, indexName)
+	}
+
+	e.mu.Lock()
+	if idx, ok := e.indices[indexName]; ok {
+		idx.Close()
+		delete(e.indices, indexName)
+	}
+	e.mu.Unlock()
+
+	if err := os.RemoveAll(e.indexPath(indexName)); err != nil {
+		return err
+	}
+
+	as, err := e.aliases()
+	if err != nil {
+		return err
+	}
+	for a, x := range as {
+		if x == indexName {
+			delete(as, a)
+		}
+	}
+	return e.putAliases(as)
+}
+
+// The operations on the aliases and on the directory layout are local
+// and quick: their Context variants only check that ctx is not done yet.
+
+// IndexNamesContext is IndexNames, unless ctx is done
+func (e *Engine) IndexNamesContext(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return e.IndexNames()
+}
+
+// IndicesContext is Indices, unless ctx is done
+func (e *Engine) IndicesContext(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return e.Indices()
+}
+
+// AliasesContext is Aliases, unless ctx is done
+func (e *Engine) AliasesContext(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return e.Aliases()
+}
+
+// AliasContext is Alias, unless ctx is done
+func (e *Engine) AliasContext(ctx context.Context, indexName string, aliasName string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return e.Alias(indexName, aliasName)
+}
+
+// UnaliasContext is Unalias, unless ctx is done
+func (e *Engine) UnaliasContext(ctx context.Context, aliasName string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return e.Unalias(aliasName)
+}
+
+// DefaultContext is Default, unless ctx is done
+func (e *Engine) DefaultContext(ctx context.Context, indexName string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return e.Default(indexName)
+}
+
+// DeleteContext is Delete, unless ctx is done
+func (e *Engine) DeleteContext(ctx context.Context, indexName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return e.Delete(indexName)
+}
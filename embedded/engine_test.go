@@ -0,0 +1,82 @@
+package embedded_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/zeroed/elasticbook"
+	"github.com/zeroed/elasticbook/embedded"
+)
+
+// newRoot returns a Bookmarks tree of two bookmarks, the second one with
+// an unparseable date
+func newRoot() *elasticbook.Root {
+	r := new(elasticbook.Root)
+	r.Roots.BookmarkBar = elasticbook.Base{
+		ID:   "1",
+		Name: "Bookmarks Bar",
+		Children: []elasticbook.Bookmark{
+			{OriginalID: "4", Name: "The Go Programming Language", URL: "https://golang.org/", Type: elasticbook.URLNodeType, DateAdded: "13094473600000000"},
+			{OriginalID: "5", Name: "Go by Example", URL: "https://gobyexample.com/", Type: elasticbook.URLNodeType, DateAdded: "yesterday"},
+		},
+	}
+	return r
+}
+
+func TestIndexAborted(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxFailures int
+		keep        bool
+		wantErr     error
+		indices     int
+		aborted     bool
+	}{
+		{name: "failures tolerated", maxFailures: -1, indices: 1},
+		{name: "aborted", maxFailures: 0, wantErr: elasticbook.ErrIndexAborted},
+		{name: "aborted and kept", maxFailures: 0, keep: true, wantErr: elasticbook.ErrIndexAborted, indices: 1, aborted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "elasticbook-embedded")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			e, err := embedded.Open(dir,
+				embedded.SetMaxFailures(tt.maxFailures),
+				embedded.SetKeepAborted(tt.keep))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer e.Close()
+
+			rep, err := e.Index(elasticbook.NewSource("", "", newRoot()))
+			if err != tt.wantErr {
+				t.Fatalf("Index() error = %v, want %v", err, tt.wantErr)
+			}
+			if rep.Aborted != (tt.wantErr != nil) {
+				t.Errorf("Aborted = %v, want %v", rep.Aborted, tt.wantErr != nil)
+			}
+
+			ins, err := e.IndexNames()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ins) != tt.indices {
+				t.Errorf("indices = %v, want %d", ins, tt.indices)
+			}
+			as, err := e.Aliases()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(as) > 0 && strings.Contains(as[0], elasticbook.AbortedAliasName); got != tt.aborted {
+				t.Errorf("aliases = %v, want aborted %v", as, tt.aborted)
+			}
+		})
+	}
+}
@@ -0,0 +1,450 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/zeroed/elasticbook"
+)
+
+// sourceField stores the whole BookmarkIndexable (not indexed), like the
+// Elasticsearch "_source"
+const sourceField = "source"
+
+// nameSort is the lowercased name, to sort by it (the name.sort of
+// Elasticsearch)
+const nameSort = "name_sort"
+
+// suggestSize is the number of names returned by Suggest
+const suggestSize = 10
+
+// newMapping mirrors the Elasticsearch mapping: the text fields are
+// analyzed, the ones used as filters are kept as they are
+func newMapping() mapping.IndexMapping {
+	text := bleve.NewTextFieldMapping()
+
+	kw := bleve.NewTextFieldMapping()
+	kw.Analyzer = keyword.Name
+	kw.IncludeInAll = false
+
+	date := bleve.NewDateTimeFieldMapping()
+	date.IncludeInAll = false
+
+	source := bleve.NewTextFieldMapping()
+	source.Index = false
+	source.IncludeInAll = false
+
+	dm := bleve.NewDocumentStaticMapping()
+	for _, f := range []string{"name", "url", "path", "tags"} {
+		dm.AddFieldMappingsAt(f, text)
+	}
+	for _, f := range []string{"folder", "root", "keyword", "source_browser", "source_profile", "domain", nameSort} {
+		dm.AddFieldMappingsAt(f, kw)
+	}
+	dm.AddFieldMappingsAt("date_added", date)
+	dm.AddFieldMappingsAt(sourceField, source)
+
+	im := bleve.NewIndexMapping()
+	im.DefaultMapping = dm
+	return im
+}
+
+// document is what Bleve indexes: the JSON fields of the bookmark, plus
+// the whole bookmark in the sourceField
+func document(b *elasticbook.BookmarkIndexable) (map[string]interface{}, error) {
+	bs, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(bs, &doc); err != nil {
+		return nil, err
+	}
+	doc[sourceField] = string(bs)
+	doc[nameSort] = strings.ToLower(b.Name)
+	return doc, nil
+}
+
+// bookmark decodes the sourceField of a hit
+func bookmark(fields map[string]interface{}) (*elasticbook.BookmarkIndexable, error) {
+	s, ok := fields[sourceField].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s field not stored", sourceField)
+	}
+	b := new(elasticbook.BookmarkIndexable)
+	return b, json.Unmarshal([]byte(s), b)
+}
+
+// Index is IndexContext with a background context
+func (e *Engine) Index(ss ...*elasticbook.Source) (*elasticbook.IndexReport, error) {
+	return e.IndexContext(context.Background(), ss...)
+}
+
+// IndexContext builds a new index from the sources, in batches (see
+// SetBatchSize). If there is no default index yet, the new one becomes
+// the default.
+// If more bookmarks than the max allowed fail (see SetMaxFailures), the
+// run is aborted: the partial index is discarded (see SetKeepAborted)
+// and ErrIndexAborted returned. If ctx is done, the partial index is
+// discarded as well and ctx.Err() returned.
+func (e *Engine) IndexContext(ctx context.Context, ss ...*elasticbook.Source) (*elasticbook.IndexReport, error) {
+	indexName := elasticbook.NewIndexName()
+	if e.exists(indexName) {
+		return nil, fmt.Errorf("Index %s already exists", indexName)
+	}
+	idx, err := bleve.New(e.indexPath(indexName), newMapping())
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	e.indices[indexName] = idx
+	e.mu.Unlock()
+
+	report := &elasticbook.IndexReport{IndexName: indexName}
+	exceeds := func() bool {
+		return e.maxFailures >= 0 && len(report.Failed) > e.maxFailures
+	}
+	batch := idx.NewBatch()
+	var ids []string
+	flush := func() {
+		if err := idx.Batch(batch); err != nil {
+			for _, id := range ids {
+				report.Failed = append(report.Failed, elasticbook.IndexFailure{ID: id, Reason: err.Error()})
+			}
+		} else {
+			report.Succeeded = append(report.Succeeded, ids...)
+		}
+		batch.Reset()
+		ids = ids[:0]
+	}
+
+	for _, s := range ss {
+		s.Documents(func(id string, b *elasticbook.BookmarkIndexable, err error) {
+			if report.Aborted || ctx.Err() != nil {
+				return
+			}
+			var doc map[string]interface{}
+			if err == nil {
+				doc, err = document(b)
+			}
+			if err == nil {
+				err = batch.Index(id, doc)
+			}
+			if err != nil {
+				report.Failed = append(report.Failed, elasticbook.IndexFailure{ID: id, Reason: err.Error()})
+				report.Aborted = exceeds()
+				return
+			}
+			ids = append(ids, id)
+			if len(ids) >= e.batchSize {
+				flush()
+				report.Aborted = exceeds()
+			}
+		})
+	}
+	if err := ctx.Err(); err != nil {
+		return report, e.discard(indexName, err)
+	}
+	if len(ids) > 0 && !report.Aborted {
+		flush()
+		report.Aborted = exceeds()
+	}
+	if report.Aborted {
+		return report, e.discard(indexName, elasticbook.ErrIndexAborted)
+	}
+
+	as, err := e.aliases()
+	if err != nil {
+		return report, err
+	}
+	if _, ok := as[elasticbook.DefaultAliasName]; !ok {
+		_, err = e.Default(indexName)
+	}
+	return report, err
+}
+
+// discard gets rid of an aborted index, and returns err: the index is
+// deleted, or marked with the AbortedAliasName if the Engine has been
+// told to keep it
+func (e *Engine) discard(indexName string, err error) error {
+	if !e.keepAborted {
+		if derr := e.Delete(indexName); derr != nil {
+			return derr
+		}
+		return err
+	}
+	as, aerr := e.aliases()
+	if aerr != nil {
+		return aerr
+	}
+	as[elasticbook.AbortedAliasName] = indexName
+	if aerr := e.putAliases(as); aerr != nil {
+		return aerr
+	}
+	return err
+}
+
+// SearchWith is SearchWithContext with a background context
+func (e *Engine) SearchWith(term string, o elasticbook.SearchOptions) (*elasticbook.SearchResult, error) {
+	return e.SearchWithContext(context.Background(), term, o)
+}
+
+// SearchWithContext looks for bookmarks in the default index, restricted
+// by the options (see Client.SearchWith)
+func (e *Engine) SearchWithContext(ctx context.Context, term string, o elasticbook.SearchOptions) (*elasticbook.SearchResult, error) {
+	pq, err := elasticbook.ParseQuery(term)
+	if err != nil {
+		return nil, err
+	}
+	q := compile(pq, o)
+
+	pg, err := elasticbook.NewPager(term, o)
+	if err != nil {
+		return nil, err
+	}
+	if pg.Index == "" {
+		if pg.Index, err = e.resolve(elasticbook.DefaultAliasName); err != nil {
+			return nil, err
+		}
+	}
+	idx, err := e.open(pg.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	req := bleve.NewSearchRequestOptions(q, pg.Size, pg.From, true)
+	req.SortBy(sortOrder(pg.Sort))
+	req.Fields = []string{sourceField}
+	res, err := idx.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	sr := &elasticbook.SearchResult{
+		TookInMillis: int64(res.Took / time.Millisecond),
+		TotalHits:    int64(res.Total),
+	}
+	for _, hit := range res.Hits {
+		b, err := bookmark(hit.Fields)
+		if err != nil {
+			return nil, err
+		}
+		sr.Hits = append(sr.Hits, &elasticbook.SearchHit{
+			ID:          hit.ID,
+			Score:       hit.Score,
+			Bookmark:    b,
+			Explanation: hit.Expl,
+		})
+	}
+	pg.Finish(sr)
+	return sr, nil
+}
+
+// sortOrder returns the Bleve sort of an order (see Client.SearchWith)
+func sortOrder(s elasticbook.Sort) []string {
+	switch s {
+	case elasticbook.SortNewest:
+		return []string{"-date_added", "_id"}
+	case elasticbook.SortOldest:
+		return []string{"date_added", "_id"}
+	case elasticbook.SortTitle:
+		return []string{nameSort, "_id"}
+	case elasticbook.SortDomain:
+		return []string{"domain", nameSort, "_id"}
+	}
+	return []string{"-_score", "-date_added", "_id"}
+}
+
+// compile turns a parsed query into a Bleve one, with the options
+// (overridden by the query ones) as filters (see Client.SearchWith)
+func compile(pq *elasticbook.Query, o elasticbook.SearchOptions) query.Query {
+	q := bleve.NewBooleanQuery()
+	if len(pq.Words) > 0 {
+		term := strings.Join(pq.Words, " ")
+		q.AddMust(bleve.NewDisjunctionQuery(
+			match(term, "name", 2),
+			match(term, "url", 1),
+			match(term, "path", 0.5)))
+		if len(pq.Words) > 1 {
+			// the names with the words together score higher (the
+			// name.shingles of Elasticsearch)
+			q.AddShould(phrase(term, "name"))
+		}
+	}
+	for _, p := range pq.Phrases {
+		q.AddMust(bleve.NewDisjunctionQuery(
+			sloppy(p, o.Slop, "name"),
+			sloppy(p, o.Slop, "url")))
+	}
+	if len(pq.Words) == 0 && len(pq.Phrases) == 0 {
+		q.AddMust(bleve.NewMatchAllQuery())
+	}
+	for _, w := range pq.NotWords {
+		q.AddMustNot(
+			field(bleve.NewMatchQuery(w), "name"),
+			field(bleve.NewMatchQuery(w), "url"))
+	}
+	for _, p := range pq.NotPhrases {
+		q.AddMustNot(sloppy(p, o.Slop, "name"), sloppy(p, o.Slop, "url"))
+	}
+
+	if len(pq.Sites) > 0 {
+		var sqs []query.Query
+		for _, s := range pq.Sites {
+			sqs = append(sqs, phrase(s, "url"))
+		}
+		q.AddMust(bleve.NewDisjunctionQuery(sqs...))
+	}
+	for _, t := range pq.Tags {
+		q.AddMust(field(bleve.NewMatchQuery(t), "tags"))
+	}
+
+	o = o.With(pq.Options)
+	if o.Folder != "" {
+		// the folder and its subfolders
+		q.AddMust(bleve.NewDisjunctionQuery(
+			field(bleve.NewTermQuery(o.Folder), "folder"),
+			field(bleve.NewPrefixQuery(o.Folder+elasticbook.PathSeparator), "folder")))
+	}
+	if o.Browser != "" {
+		q.AddMust(field(bleve.NewTermQuery(o.Browser), "source_browser"))
+	}
+	if o.Profile != "" {
+		q.AddMust(field(bleve.NewTermQuery(o.Profile), "source_profile"))
+	}
+	if !o.After.IsZero() || !o.Before.IsZero() {
+		// the zero Times are open bounds
+		q.AddMust(field(bleve.NewDateRangeQuery(o.After, o.Before), "date_added"))
+	}
+
+	return q
+}
+
+// phrase is a match phrase query on a field
+func phrase(p string, f string) query.Query {
+	q := bleve.NewMatchPhraseQuery(p)
+	q.SetField(f)
+	return q
+}
+
+// sloppy is a phrase query on a field. Bleve has no slop: with one, all
+// the words must be found, anywhere in the field.
+func sloppy(p elasticbook.Phrase, dflt int, f string) query.Query {
+	if p.SlopOr(dflt) == 0 {
+		return phrase(p.Text, f)
+	}
+	q := bleve.NewMatchQuery(p.Text)
+	q.SetField(f)
+	q.SetOperator(query.MatchQueryOperatorAnd)
+	return q
+}
+
+// match is a fuzzy match query on a field (with a boost)
+func match(term string, f string, boost float64) query.Query {
+	q := bleve.NewMatchQuery(term)
+	q.SetField(f)
+	q.SetBoost(boost)
+	q.SetFuzziness(1)
+	q.SetPrefix(2)
+	return q
+}
+
+// fielder is a query restricted to a field
+type fielder interface {
+	query.Query
+	SetField(f string)
+}
+
+func field(q fielder, f string) query.Query {
+	q.SetField(f)
+	return q
+}
+
+// Suggest is SuggestContext with a background context
+func (e *Engine) Suggest(term string) ([]string, error) {
+	return e.SuggestContext(context.Background(), term)
+}
+
+// SuggestContext returns the names (of the bookmarks in the default
+// index) with a word starting with term
+func (e *Engine) SuggestContext(ctx context.Context, term string) ([]string, error) {
+	indexName, err := e.resolve(elasticbook.DefaultAliasName)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := e.open(indexName)
+	if err != nil {
+		return nil, err
+	}
+
+	q := bleve.NewPrefixQuery(strings.ToLower(term))
+	q.SetField("name")
+	req := bleve.NewSearchRequestOptions(q, suggestSize, 0, false)
+	req.Fields = []string{sourceField}
+	res, err := idx.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, hit := range res.Hits {
+		b, err := bookmark(hit.Fields)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[b.Name] {
+			seen[b.Name] = true
+			names = append(names, b.Name)
+		}
+	}
+	return names, nil
+}
+
+// Scan is ScanContext with a background context
+func (e *Engine) Scan(name string, fn func(id string, b *elasticbook.BookmarkIndexable) error) error {
+	return e.ScanContext(context.Background(), name, fn)
+}
+
+// ScanContext visits all the bookmarks of an index (or an alias), with
+// their document ID. It stops at the first error fn returns.
+func (e *Engine) ScanContext(ctx context.Context, name string, fn func(id string, b *elasticbook.BookmarkIndexable) error) error {
+	indexName, err := e.resolve(name)
+	if err != nil {
+		return err
+	}
+	idx, err := e.open(indexName)
+	if err != nil {
+		return err
+	}
+
+	size := elasticbook.DefaultBulkActions
+	for from := 0; ; from += size {
+		req := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), size, from, false)
+		req.Fields = []string{sourceField}
+		req.SortBy([]string{"_id"})
+		res, err := idx.SearchInContext(ctx, req)
+		if err != nil {
+			return err
+		}
+		for _, hit := range res.Hits {
+			b, err := bookmark(hit.Fields)
+			if err != nil {
+				return err
+			}
+			if err := fn(hit.ID, b); err != nil {
+				return err
+			}
+		}
+		if len(res.Hits) < size {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package elasticbook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"gopkg.in/olivere/elastic.v3"
+)
+
+// ErrClusterUnreachable is returned when the Elasticsearch cluster does
+// not answer
+var ErrClusterUnreachable = errors.New("cluster unreachable")
+
+// ErrIndexNotFound is returned when an index (or an alias) does not exist
+var ErrIndexNotFound = errors.New("index not found")
+
+// ErrAliasConflict is returned when an alias is already taken (see
+// Client.Alias)
+var ErrAliasConflict = errors.New("alias conflict")
+
+// ErrIndexAborted is returned by Index when too many bookmarks failed
+var ErrIndexAborted = errors.New("indexing aborted: too many failures")
+
+// ErrUnparseableDate is returned when a Chrome timestamp is not a number,
+// or a date expression is not understood (see ParseDate)
+var ErrUnparseableDate = errors.New("unparseable date")
+
+// ErrQuerySyntax is returned when a search query is malformed (see
+// ParseQuery)
+var ErrQuerySyntax = errors.New("query syntax error")
+
+// ErrBadCursor is returned when a search cursor is malformed, or comes
+// from another search (see SearchOptions.Cursor)
+var ErrBadCursor = errors.New("bad cursor")
+
+// ErrUnknownSort is returned when a search is sorted by an unknown order
+// (see Sorts)
+var ErrUnknownSort = errors.New("unknown sort")
+
+// wrapError maps the errors of the elastic package to the sentinel
+// errors above, so the callers can check them with errors.Is
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	if err == elastic.ErrNoClient {
+		return fmt.Errorf("%w: %s", ErrClusterUnreachable, err)
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return fmt.Errorf("%w: %s", ErrClusterUnreachable, err)
+	}
+	if elastic.IsNotFound(err) {
+		return fmt.Errorf("%w: %s", ErrIndexNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,801 @@
+package estest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// hit is a document matched by a query
+type hit struct {
+	Index  string
+	Type   string
+	ID     string
+	Score  float64
+	Source json.RawMessage
+
+	doc map[string]interface{}
+	// noScore is set when the hits are sorted without tracking the
+	// scores: Elasticsearch returns a null _score
+	noScore bool
+}
+
+func (h *hit) json(explain bool) map[string]interface{} {
+	m := map[string]interface{}{
+		"_index":  h.Index,
+		"_type":   h.Type,
+		"_id":     h.ID,
+		"_score":  h.Score,
+		"_source": h.Source,
+	}
+	if h.noScore {
+		m["_score"] = nil
+	}
+	if explain {
+		m["_explanation"] = map[string]interface{}{
+			"value":       h.Score,
+			"description": "estest: matched terms, times their boost",
+			"details":     []interface{}{},
+		}
+	}
+	return m
+}
+
+// searchRequest is the body of a search (or count) request
+type searchRequest struct {
+	Query   map[string]interface{} `json:"query"`
+	From    *int                   `json:"from"`
+	Size    *int                   `json:"size"`
+	Explain bool                   `json:"explain"`
+	Sort    []interface{}          `json:"sort"`
+	// TrackScores keeps the scores of a sorted search
+	TrackScores bool `json:"track_scores"`
+}
+
+// match returns the documents matched by the query in the body, best
+// scores first (or in the order of the sort of the body)
+func (s *Server) match(names string, typ string, body []byte) ([]*hit, error) {
+	var req searchRequest
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+	}
+	ns, err := s.resolve(names)
+	if err != nil {
+		return nil, err
+	}
+
+	var hs []*hit
+	for _, n := range ns {
+		ix := s.indices[n]
+		for _, d := range ix.docs {
+			if typ != "" && d.Type != typ {
+				continue
+			}
+			var doc map[string]interface{}
+			if err := json.Unmarshal(d.Source, &doc); err != nil {
+				return nil, err
+			}
+			ok, score, err := s.eval(ix, d.Type, req.Query, doc)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				hs = append(hs, &hit{Index: n, Type: d.Type, ID: d.ID, Score: score, Source: d.Source, doc: doc})
+			}
+		}
+	}
+	sort.Sort(byScore(hs))
+	if len(req.Sort) > 0 {
+		s.sortHits(hs, req.Sort)
+		noScore := !req.TrackScores && !sortsByScore(req.Sort)
+		for _, h := range hs {
+			h.noScore = noScore
+		}
+	}
+	return hs, nil
+}
+
+// sortKey is a field of a sort, with its order
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+// sortKeys parses a sort: every item is "field", {"field": "desc"} or
+// {"field": {"order": "desc"}}; the default order is ascending (but
+// descending for _score).
+func sortKeys(sorts []interface{}) []sortKey {
+	var keys []sortKey
+	for _, x := range sorts {
+		switch v := x.(type) {
+		case string:
+			keys = append(keys, sortKey{v, v == "_score"})
+		case map[string]interface{}:
+			for f, o := range v {
+				order, _ := o.(string)
+				if m, ok := o.(map[string]interface{}); ok {
+					order, _ = m["order"].(string)
+				}
+				desc := order == "desc" || order == "" && f == "_score"
+				keys = append(keys, sortKey{f, desc})
+			}
+		}
+	}
+	return keys
+}
+
+// sortsByScore tells if a sort uses the _score
+func sortsByScore(sorts []interface{}) bool {
+	for _, k := range sortKeys(sorts) {
+		if k.field == "_score" {
+			return true
+		}
+	}
+	return false
+}
+
+// sortHits sorts the hits by _score, _uid (or _id) or the fields of the
+// documents (see sortKeys). The fields with a lowercase analyzer are
+// compared lowercased.
+func (s *Server) sortHits(hs []*hit, sorts []interface{}) {
+	keys := sortKeys(sorts)
+
+	value := func(h *hit, f string) interface{} {
+		switch f {
+		case "_score":
+			return h.Score
+		case "_uid":
+			return h.Type + "#" + h.ID
+		case "_id":
+			return h.ID
+		}
+		vs := fieldValues(h.doc, f)
+		if len(vs) == 0 {
+			return nil
+		}
+		if str, ok := vs[0].(string); ok && s.lowercased(s.indices[h.Index], h.Type, f) {
+			return strings.ToLower(str)
+		}
+		return vs[0]
+	}
+
+	sort.SliceStable(hs, func(i, j int) bool {
+		for _, k := range keys {
+			a, b := value(hs[i], k.field), value(hs[j], k.field)
+			if a == nil || b == nil {
+				// the missing values go last
+				if a == nil && b == nil {
+					continue
+				}
+				return b == nil
+			}
+			c := compare(a, b)
+			if c == 0 {
+				continue
+			}
+			return (c < 0) != k.desc
+		}
+		return false
+	})
+}
+
+type byScore []*hit
+
+func (hs byScore) Len() int      { return len(hs) }
+func (hs byScore) Swap(i, j int) { hs[i], hs[j] = hs[j], hs[i] }
+func (hs byScore) Less(i, j int) bool {
+	if hs[i].Score != hs[j].Score {
+		return hs[i].Score > hs[j].Score
+	}
+	if hs[i].Index != hs[j].Index {
+		return hs[i].Index < hs[j].Index
+	}
+	return hs[i].ID < hs[j].ID
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request, names string, typ string, body []byte) {
+	var req searchRequest
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+			return
+		}
+	}
+	hs, err := s.match(names, typ, body)
+	if err != nil {
+		status := http.StatusBadRequest
+		if strings.HasPrefix(err.Error(), "no such index") {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, "search_phase_execution_exception", err.Error())
+		return
+	}
+
+	size := 10
+	if req.Size != nil {
+		size = *req.Size
+	}
+	if v := r.URL.Query().Get("size"); v != "" {
+		size, _ = strconv.Atoi(v)
+	}
+
+	if r.URL.Query().Get("scroll") != "" {
+		s.nextID++
+		id := fmt.Sprintf("estest-scroll-%d", s.nextID)
+		s.scrolls[id] = &scroll{hits: hs, size: size, total: len(hs)}
+		s.writeScroll(w, id)
+		return
+	}
+
+	from := 0
+	if req.From != nil {
+		from = *req.From
+	}
+	total := len(hs)
+	if from > len(hs) {
+		from = len(hs)
+	}
+	hs = hs[from:]
+	if size < len(hs) {
+		hs = hs[:size]
+	}
+	writeHits(w, hs, total, req.Explain, "")
+}
+
+// nextScroll returns the next page of a scroll: the id is the body, a
+// JSON {"scroll_id": ...} or a parameter
+func (s *Server) nextScroll(w http.ResponseWriter, r *http.Request, body []byte) {
+	if r.Method == "DELETE" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"succeeded": true})
+		return
+	}
+	id := strings.TrimSpace(string(body))
+	var req struct {
+		ScrollID string `json:"scroll_id"`
+	}
+	if json.Unmarshal(body, &req) == nil && req.ScrollID != "" {
+		id = req.ScrollID
+	}
+	if v := r.URL.Query().Get("scroll_id"); v != "" {
+		id = v
+	}
+	if _, ok := s.scrolls[id]; !ok {
+		writeError(w, http.StatusNotFound, "search_context_missing_exception", "No search context found for id ["+id+"]")
+		return
+	}
+	s.writeScroll(w, id)
+}
+
+func (s *Server) writeScroll(w http.ResponseWriter, id string) {
+	sc := s.scrolls[id]
+	hs := sc.hits
+	if sc.size < len(hs) {
+		hs = hs[:sc.size]
+	}
+	sc.hits = sc.hits[len(hs):]
+	writeHits(w, hs, sc.total, false, id)
+}
+
+func writeHits(w http.ResponseWriter, hs []*hit, total int, explain bool, scrollID string) {
+	var max float64
+	list := make([]interface{}, len(hs))
+	for i, h := range hs {
+		if h.Score > max {
+			max = h.Score
+		}
+		list[i] = h.json(explain)
+	}
+	res := map[string]interface{}{
+		"took":      1,
+		"timed_out": false,
+		"_shards":   map[string]int{"total": 1, "successful": 1, "failed": 0},
+		"hits": map[string]interface{}{
+			"total":     total,
+			"max_score": max,
+			"hits":      list,
+		},
+	}
+	if scrollID != "" {
+		res["_scroll_id"] = scrollID
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// suggest answers the completion suggesters (prefix match on the inputs);
+// the other suggesters find nothing
+func (s *Server) suggest(w http.ResponseWriter, names string, body []byte) {
+	var req map[string]struct {
+		Text       string `json:"text"`
+		Completion *struct {
+			Field string `json:"field"`
+			Size  int    `json:"size"`
+		} `json:"completion"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+	ns, err := s.resolve(names)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "index_not_found_exception", err.Error())
+		return
+	}
+
+	res := map[string]interface{}{
+		"_shards": map[string]int{"total": 1, "successful": 1, "failed": 0},
+	}
+	for name, sg := range req {
+		options := []interface{}{}
+		if sg.Completion != nil {
+			size := sg.Completion.Size
+			if size == 0 {
+				size = 5
+			}
+			prefix := strings.ToLower(sg.Text)
+			seen := make(map[string]bool)
+			var texts []string
+			for _, n := range ns {
+				for _, d := range s.indices[n].docs {
+					var doc map[string]interface{}
+					if json.Unmarshal(d.Source, &doc) != nil {
+						continue
+					}
+					for _, t := range completions(doc[sg.Completion.Field], prefix) {
+						if !seen[t] {
+							seen[t] = true
+							texts = append(texts, t)
+						}
+					}
+				}
+			}
+			sort.Strings(texts)
+			for i, t := range texts {
+				if i == size {
+					break
+				}
+				options = append(options, map[string]interface{}{"text": t, "score": 1})
+			}
+		}
+		res[name] = []interface{}{map[string]interface{}{
+			"text": sg.Text, "offset": 0, "length": len(sg.Text), "options": options,
+		}}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// completions returns the output of a completion field (a string, a list
+// or an {"input", "output"} object) if an input starts with prefix
+func completions(v interface{}, prefix string) []string {
+	var inputs []interface{}
+	var output string
+	switch x := v.(type) {
+	case string:
+		inputs, output = []interface{}{x}, x
+	case []interface{}:
+		var ts []string
+		for _, y := range x {
+			ts = append(ts, completions(y, prefix)...)
+		}
+		return ts
+	case map[string]interface{}:
+		switch in := x["input"].(type) {
+		case []interface{}:
+			inputs = in
+		case string:
+			inputs = []interface{}{in}
+		}
+		output, _ = x["output"].(string)
+	}
+	for _, in := range inputs {
+		s, _ := in.(string)
+		if strings.HasPrefix(strings.ToLower(s), prefix) {
+			if output == "" {
+				output = s
+			}
+			return []string{output}
+		}
+	}
+	return nil
+}
+
+// eval matches a query against a document, returning its score. A nil
+// query matches everything.
+func (s *Server) eval(ix *index, typ string, q map[string]interface{}, doc map[string]interface{}) (bool, float64, error) {
+	if len(q) == 0 {
+		return true, 1, nil
+	}
+	for kind, body := range q {
+		m, _ := body.(map[string]interface{})
+		switch kind {
+		case "match_all":
+			return true, 1, nil
+		case "bool":
+			return s.evalBool(ix, typ, m, doc)
+		case "term":
+			return s.evalTerm(ix, typ, m, doc, false)
+		case "terms":
+			return s.evalTerm(ix, typ, m, doc, true)
+		case "range":
+			return evalRange(m, doc), 1, nil
+		case "match", "match_phrase":
+			for f, v := range m {
+				text, boost := queryText(v)
+				match := matchText
+				if o, ok := v.(map[string]interface{}); kind == "match_phrase" || ok && o["type"] == "phrase" {
+					match = phraseMatcher(o["slop"])
+				}
+				score := match(text, fieldValues(doc, f)) * boost
+				return score > 0, score, nil
+			}
+			return false, 0, nil
+		case "multi_match":
+			text, _ := m["query"].(string)
+			fields, _ := m["fields"].([]interface{})
+			match := matchText
+			if m["type"] == "phrase" {
+				match = phraseMatcher(m["slop"])
+			}
+			var score float64
+			for _, f := range fields {
+				name, boost := fieldBoost(fmt.Sprint(f))
+				score += match(text, fieldValues(doc, name)) * boost
+			}
+			return score > 0, score, nil
+		default:
+			return false, 0, fmt.Errorf("estest: %s query not supported", kind)
+		}
+	}
+	return false, 0, nil
+}
+
+func (s *Server) evalBool(ix *index, typ string, m map[string]interface{}, doc map[string]interface{}) (bool, float64, error) {
+	var score float64
+	scored := false
+	for _, clause := range []string{"must", "filter", "should", "must_not"} {
+		qs := clauses(m[clause])
+		matched := 0
+		for _, q := range qs {
+			ok, sc, err := s.eval(ix, typ, q, doc)
+			if err != nil {
+				return false, 0, err
+			}
+			if ok {
+				matched++
+				if clause == "must" || clause == "should" {
+					score += sc
+					scored = true
+				}
+			}
+		}
+		switch clause {
+		case "must", "filter":
+			if matched < len(qs) {
+				return false, 0, nil
+			}
+		case "should":
+			_, must := m["must"]
+			_, filter := m["filter"]
+			if len(qs) > 0 && matched == 0 && !must && !filter {
+				return false, 0, nil
+			}
+		case "must_not":
+			if matched > 0 {
+				return false, 0, nil
+			}
+		}
+	}
+	if !scored {
+		score = 1
+	}
+	return true, score, nil
+}
+
+// clauses returns the queries of a bool clause (a query or a list)
+func clauses(v interface{}) []map[string]interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{x}
+	case []interface{}:
+		var qs []map[string]interface{}
+		for _, y := range x {
+			if q, ok := y.(map[string]interface{}); ok {
+				qs = append(qs, q)
+			}
+		}
+		return qs
+	}
+	return nil
+}
+
+// evalTerm matches the exact values. A field analyzed with a
+// path_hierarchy tokenizer matches the whole subtree.
+func (s *Server) evalTerm(ix *index, typ string, m map[string]interface{}, doc map[string]interface{}, many bool) (bool, float64, error) {
+	for f, v := range m {
+		var wanted []interface{}
+		switch {
+		case many:
+			wanted, _ = v.([]interface{})
+		default:
+			if o, ok := v.(map[string]interface{}); ok {
+				v = o["value"]
+			}
+			wanted = []interface{}{v}
+		}
+		delimiter := s.pathDelimiter(ix, typ, f)
+		for _, x := range fieldValues(doc, f) {
+			for _, w := range wanted {
+				xs, ws := fmt.Sprint(x), fmt.Sprint(w)
+				if xs == ws || (delimiter != "" && strings.HasPrefix(xs, ws+delimiter)) {
+					return true, 1, nil
+				}
+			}
+		}
+		return false, 0, nil
+	}
+	return false, 0, nil
+}
+
+// evalRange matches the values within the bounds, given as gt/gte/lt/lte
+// or as from/to with include_lower/include_upper (the elastic package
+// way)
+func evalRange(m map[string]interface{}, doc map[string]interface{}) bool {
+	for f, v := range m {
+		r, _ := v.(map[string]interface{})
+		type bound struct {
+			value     interface{}
+			inclusive bool
+			lower     bool
+		}
+		var bs []bound
+		for k, x := range r {
+			switch k {
+			case "gt", "gte":
+				bs = append(bs, bound{x, k == "gte", true})
+			case "lt", "lte":
+				bs = append(bs, bound{x, k == "lte", false})
+			case "from", "to":
+				if x == nil {
+					continue
+				}
+				include := "include_upper"
+				if k == "from" {
+					include = "include_lower"
+				}
+				inclusive, ok := r[include].(bool)
+				bs = append(bs, bound{x, inclusive || !ok, k == "from"})
+			}
+		}
+		for _, x := range fieldValues(doc, f) {
+			ok := true
+			for _, b := range bs {
+				c := compare(x, b.value)
+				switch {
+				case b.lower && (c < 0 || c == 0 && !b.inclusive):
+					ok = false
+				case !b.lower && (c > 0 || c == 0 && !b.inclusive):
+					ok = false
+				}
+			}
+			if ok {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// compare compares two values as dates, numbers or strings (the first
+// kind both parse as)
+func compare(a interface{}, b interface{}) int {
+	as, bs := fmt.Sprint(a), fmt.Sprint(b)
+	if ta, err := time.Parse(time.RFC3339Nano, as); err == nil {
+		if tb, err := time.Parse(time.RFC3339Nano, bs); err == nil {
+			switch {
+			case ta.Before(tb):
+				return -1
+			case ta.After(tb):
+				return 1
+			}
+			return 0
+		}
+	}
+	if fa, err := strconv.ParseFloat(as, 64); err == nil {
+		if fb, err := strconv.ParseFloat(bs, 64); err == nil {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(as, bs)
+}
+
+// analysis returns the custom analyzer used by a field (nil if none), and
+// the analysis settings of the index
+func (s *Server) analysis(ix *index, typ string, field string) (map[string]interface{}, map[string]interface{}) {
+	if ix == nil {
+		return nil, nil
+	}
+	props, _ := ix.mappings[typ]["properties"].(map[string]interface{})
+	var fm map[string]interface{}
+	for i, p := range strings.Split(field, ".") {
+		if i > 0 {
+			props, _ = fm["fields"].(map[string]interface{})
+		}
+		fm, _ = props[p].(map[string]interface{})
+	}
+	analyzer, _ := fm["analyzer"].(string)
+	if analyzer == "" {
+		return nil, nil
+	}
+
+	settings := ix.settings
+	if x, ok := settings["index"].(map[string]interface{}); ok {
+		settings = x
+	}
+	analysis, _ := settings["analysis"].(map[string]interface{})
+	analyzers, _ := analysis["analyzer"].(map[string]interface{})
+	a, _ := analyzers[analyzer].(map[string]interface{})
+	return a, analysis
+}
+
+// lowercased tells if a field is analyzed with a lowercase filter
+func (s *Server) lowercased(ix *index, typ string, field string) bool {
+	a, _ := s.analysis(ix, typ, field)
+	fs, _ := a["filter"].([]interface{})
+	for _, f := range fs {
+		if f == "lowercase" {
+			return true
+		}
+	}
+	return false
+}
+
+// pathDelimiter returns the delimiter of the path_hierarchy tokenizer
+// used by a field, if any
+func (s *Server) pathDelimiter(ix *index, typ string, field string) string {
+	a, analysis := s.analysis(ix, typ, field)
+	if a == nil {
+		return ""
+	}
+	tokenizers, _ := analysis["tokenizer"].(map[string]interface{})
+	t, _ := tokenizers[fmt.Sprint(a["tokenizer"])].(map[string]interface{})
+	if t["type"] != "path_hierarchy" {
+		return ""
+	}
+	if d, ok := t["delimiter"].(string); ok {
+		return d
+	}
+	return "/"
+}
+
+// fieldValues returns the values of a (dotted) field. A multi field
+// ("path.text") falls back to its parent.
+func fieldValues(doc map[string]interface{}, field string) []interface{} {
+	ps := strings.Split(field, ".")
+	for n := len(ps); n > 0; n-- {
+		var v interface{} = doc
+		found := true
+		for _, p := range ps[:n] {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				found = false
+				break
+			}
+			if v, ok = m[p]; !ok {
+				found = false
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		if xs, ok := v.([]interface{}); ok {
+			return xs
+		}
+		return []interface{}{v}
+	}
+	return nil
+}
+
+// fieldBoost splits "name^2" in the field and its boost
+func fieldBoost(f string) (string, float64) {
+	xs := strings.SplitN(f, "^", 2)
+	if len(xs) == 1 {
+		return f, 1
+	}
+	b, err := strconv.ParseFloat(xs[1], 64)
+	if err != nil {
+		return xs[0], 1
+	}
+	return xs[0], b
+}
+
+// queryText returns the text of a match query ("text" or
+// {"query": "text", "boost": 2})
+func queryText(v interface{}) (string, float64) {
+	if o, ok := v.(map[string]interface{}); ok {
+		text, _ := o["query"].(string)
+		boost, ok := o["boost"].(float64)
+		if !ok {
+			boost = 1
+		}
+		return text, boost
+	}
+	return fmt.Sprint(v), 1
+}
+
+// matchText counts the words of text found (as a prefix) in the values
+func matchText(text string, values []interface{}) float64 {
+	var words []string
+	for _, v := range values {
+		words = append(words, tokenize(fmt.Sprint(v))...)
+	}
+	var n float64
+	for _, t := range tokenize(text) {
+		for _, w := range words {
+			if strings.HasPrefix(w, t) {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// phraseMatcher returns a matchPhrase with the slop of a query (a JSON
+// number, if any)
+func phraseMatcher(slop interface{}) func(string, []interface{}) float64 {
+	n, _ := slop.(float64)
+	return func(text string, values []interface{}) float64 {
+		return matchPhrase(text, values, int(n))
+	}
+}
+
+// matchPhrase counts the words of text if they are found in order in one
+// of the values, with at most slop other words in between (a naive slop:
+// Elasticsearch allows the words to swap too)
+func matchPhrase(text string, values []interface{}, slop int) float64 {
+	ts := tokenize(text)
+	if len(ts) == 0 {
+		return 0
+	}
+	for _, v := range values {
+		words := tokenize(fmt.Sprint(v))
+		for i, w := range words {
+			if w != ts[0] {
+				continue
+			}
+			j, gaps := i+1, 0
+			for _, t := range ts[1:] {
+				for j < len(words) && words[j] != t {
+					j++
+					gaps++
+				}
+				j++
+			}
+			if j <= len(words) && gaps <= slop {
+				return float64(len(ts))
+			}
+		}
+	}
+	return 0
+}
+
+// tokenize lowercases and splits on anything but letters and digits
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,638 @@
+// Package estest is an in-memory stand-in for an Elasticsearch (2.x)
+// cluster, to test elasticbook without one.
+//
+// It speaks the subset of the REST API elasticbook uses: create, delete
+// and check indices, get and put mappings, index and bulk documents,
+// search (and scroll), suggest, aliases, count, refresh and health.
+// The queries are matched naively (see query.go): good enough to tell
+// which bookmarks a search finds, not how Elasticsearch would rank them.
+package estest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/olivere/elastic.v3"
+)
+
+// Version is the Elasticsearch version the Server claims to be
+const Version = "2.1.1"
+
+// Server is a fake Elasticsearch cluster listening on a local port
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	indices  map[string]*index
+	scrolls  map[string]*scroll
+	rejected map[string]string
+	nextID   int
+}
+
+type index struct {
+	settings map[string]interface{}
+	mappings map[string]map[string]interface{}
+	aliases  map[string]bool
+	docs     map[string]*document
+}
+
+type document struct {
+	Type    string
+	ID      string
+	Version int
+	Source  json.RawMessage
+}
+
+type scroll struct {
+	hits  []*hit
+	size  int
+	total int
+}
+
+// NewServer starts a Server. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		indices:  make(map[string]*index),
+		scrolls:  make(map[string]*scroll),
+		rejected: make(map[string]string),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// NewClient returns an elastic Client talking to the Server (with no
+// sniffing and no health checks)
+func (s *Server) NewClient() (*elastic.Client, error) {
+	return elastic.NewClient(
+		elastic.SetURL(s.URL),
+		elastic.SetSniff(false),
+		elastic.SetHealthcheck(false))
+}
+
+// CreateIndex adds an empty index
+func (s *Server) CreateIndex(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.create(name, nil)
+}
+
+// AddAlias adds an alias to an (existing) index
+func (s *Server) AddAlias(indexName string, aliasName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ix, ok := s.indices[indexName]; ok {
+		ix.aliases[aliasName] = true
+	}
+}
+
+// Put stores a document, creating the index if needed
+func (s *Server) Put(indexName string, typ string, id string, source interface{}) error {
+	b, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(s.create(indexName, nil), typ, id, b)
+	return nil
+}
+
+// Reject makes the bulk requests for the document id fail with reason
+func (s *Server) Reject(id string, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejected[id] = reason
+}
+
+// IndexNames returns the indices, sorted
+func (s *Server) IndexNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ns []string
+	for n := range s.indices {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+	return ns
+}
+
+// Aliases returns the aliases of an index, sorted
+func (s *Server) Aliases(indexName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var as []string
+	if ix, ok := s.indices[indexName]; ok {
+		for a := range ix.aliases {
+			as = append(as, a)
+		}
+	}
+	sort.Strings(as)
+	return as
+}
+
+// Docs returns the sources of the documents of an index, by ID
+func (s *Server) Docs(indexName string) map[string]json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ds := make(map[string]json.RawMessage)
+	if ix, ok := s.indices[indexName]; ok {
+		for id, d := range ix.docs {
+			ds[id] = d.Source
+		}
+	}
+	return ds
+}
+
+// Mapping returns the mapping of a type
+func (s *Server) Mapping(indexName string, typ string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ix, ok := s.indices[indexName]; ok {
+		return ix.mappings[typ]
+	}
+	return nil
+}
+
+func (s *Server) create(name string, settings map[string]interface{}) *index {
+	if ix, ok := s.indices[name]; ok {
+		return ix
+	}
+	ix := &index{
+		settings: settings,
+		mappings: make(map[string]map[string]interface{}),
+		aliases:  make(map[string]bool),
+		docs:     make(map[string]*document),
+	}
+	s.indices[name] = ix
+	return ix
+}
+
+func (s *Server) put(ix *index, typ string, id string, source []byte) (*document, bool) {
+	if id == "" {
+		s.nextID++
+		id = strconv.Itoa(s.nextID)
+	}
+	d, ok := ix.docs[id]
+	if !ok {
+		d = &document{ID: id}
+		ix.docs[id] = d
+	}
+	d.Type = typ
+	d.Version++
+	d.Source = json.RawMessage(source)
+	return d, !ok
+}
+
+// resolve expands a comma separated list of indices and aliases ("_all"
+// is every index)
+func (s *Server) resolve(names string) ([]string, error) {
+	var ns []string
+	seen := make(map[string]bool)
+	add := func(n string) {
+		if !seen[n] {
+			seen[n] = true
+			ns = append(ns, n)
+		}
+	}
+	for _, name := range strings.Split(names, ",") {
+		if name == "_all" || name == "*" {
+			for n := range s.indices {
+				add(n)
+			}
+			continue
+		}
+		if _, ok := s.indices[name]; ok {
+			add(name)
+			continue
+		}
+		found := false
+		for n, ix := range s.indices {
+			if ix.aliases[name] {
+				add(n)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no such index [%s]", name)
+		}
+	}
+	sort.Strings(ns)
+	return ns, nil
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ps []string
+	for _, p := range strings.Split(strings.Trim(r.URL.Path, "/"), "/") {
+		if p != "" {
+			ps = append(ps, p)
+		}
+	}
+
+	switch {
+	case len(ps) == 0:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"name":         "estest",
+			"cluster_name": "estest",
+			"version":      map[string]interface{}{"number": Version},
+			"tagline":      "You Know, for Search",
+		})
+	case ps[0] == "_bulk":
+		s.bulk(w, body)
+	case ps[0] == "_aliases" && r.Method == "POST":
+		s.updateAliases(w, body)
+	case ps[0] == "_aliases":
+		s.getAliases(w, "_all")
+	case ps[0] == "_cluster" && len(ps) > 1 && ps[1] == "health":
+		s.health(w)
+	case ps[0] == "_search" && len(ps) > 1 && ps[1] == "scroll":
+		s.nextScroll(w, r, body)
+	case len(ps) == 1:
+		s.indexOp(w, r, ps[0], body)
+	default:
+		s.subOp(w, r, ps, body)
+	}
+}
+
+// indexOp handles the requests on a whole index
+func (s *Server) indexOp(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	switch r.Method {
+	case "HEAD":
+		if _, err := s.resolve(name); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case "PUT", "POST":
+		if _, ok := s.indices[name]; ok {
+			writeError(w, http.StatusBadRequest, "index_already_exists_exception", "already exists")
+			return
+		}
+		var req struct {
+			Settings map[string]interface{}            `json:"settings"`
+			Mappings map[string]map[string]interface{} `json:"mappings"`
+		}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+				return
+			}
+		}
+		ix := s.create(name, req.Settings)
+		for t, m := range req.Mappings {
+			ix.mappings[t] = m
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"acknowledged": true})
+	case "DELETE":
+		ns, err := s.resolve(name)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "index_not_found_exception", err.Error())
+			return
+		}
+		for _, n := range ns {
+			delete(s.indices, n)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"acknowledged": true})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "illegal_argument_exception", r.Method)
+	}
+}
+
+// subOp handles /{index}/_something, /{index}/{type}/_something and
+// /{index}/{type}/{id}
+func (s *Server) subOp(w http.ResponseWriter, r *http.Request, ps []string, body []byte) {
+	names, rest := ps[0], ps[1:]
+	op := rest[len(rest)-1]
+	typ := ""
+	if len(rest) > 1 && !strings.HasPrefix(rest[0], "_") {
+		typ = rest[0]
+	}
+
+	switch {
+	case rest[0] == "_aliases":
+		s.getAliases(w, names)
+	case rest[0] == "_settings":
+		s.getSettings(w, names)
+	case rest[0] == "_mapping" && (r.Method == "PUT" || r.Method == "POST"):
+		if len(rest) > 1 {
+			typ = rest[1]
+		}
+		s.putMapping(w, names, typ, body)
+	case rest[0] == "_mapping":
+		if len(rest) > 1 {
+			typ = rest[1]
+		}
+		s.getMapping(w, names, typ)
+	case op == "_refresh":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"_shards": map[string]int{"total": 1, "successful": 1, "failed": 0},
+		})
+	case op == "_count":
+		s.count(w, names, typ, body)
+	case op == "_search":
+		s.search(w, r, names, typ, body)
+	case op == "_suggest":
+		s.suggest(w, names, body)
+	case len(rest) == 2:
+		s.doc(w, r, names, rest[0], rest[1], body)
+	default:
+		writeError(w, http.StatusBadRequest, "illegal_argument_exception",
+			fmt.Sprintf("estest: %s %s not supported", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) doc(w http.ResponseWriter, r *http.Request, indexName, typ, id string, body []byte) {
+	switch r.Method {
+	case "PUT", "POST":
+		d, created := s.put(s.create(indexName, nil), typ, id, body)
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, map[string]interface{}{
+			"_index": indexName, "_type": typ, "_id": d.ID,
+			"_version": d.Version, "created": created,
+		})
+	case "GET", "HEAD", "DELETE":
+		ns, err := s.resolve(indexName)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "index_not_found_exception", err.Error())
+			return
+		}
+		for _, n := range ns {
+			d, ok := s.indices[n].docs[id]
+			if !ok {
+				continue
+			}
+			if r.Method == "DELETE" {
+				delete(s.indices[n].docs, id)
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"_index": n, "_type": d.Type, "_id": id, "_version": d.Version,
+				"found": true, "_source": d.Source,
+			})
+			return
+		}
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"_index": indexName, "_type": typ, "_id": id, "found": false,
+		})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "illegal_argument_exception", r.Method)
+	}
+}
+
+func (s *Server) getAliases(w http.ResponseWriter, names string) {
+	ns, err := s.resolve(names)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "index_not_found_exception", err.Error())
+		return
+	}
+	res := make(map[string]interface{})
+	for _, n := range ns {
+		as := make(map[string]interface{})
+		for a := range s.indices[n].aliases {
+			as[a] = map[string]interface{}{}
+		}
+		res[n] = map[string]interface{}{"aliases": as}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// updateAliases applies the actions all together: nothing changes if one
+// of them refers to a missing index
+func (s *Server) updateAliases(w http.ResponseWriter, body []byte) {
+	var req struct {
+		Actions []map[string]struct {
+			Index string `json:"index"`
+			Alias string `json:"alias"`
+		} `json:"actions"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+	for _, a := range req.Actions {
+		for _, x := range a {
+			if _, ok := s.indices[x.Index]; !ok {
+				writeError(w, http.StatusNotFound, "index_not_found_exception",
+					fmt.Sprintf("no such index [%s]", x.Index))
+				return
+			}
+		}
+	}
+	for _, a := range req.Actions {
+		for op, x := range a {
+			switch op {
+			case "add":
+				s.indices[x.Index].aliases[x.Alias] = true
+			case "remove":
+				delete(s.indices[x.Index].aliases, x.Alias)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"acknowledged": true})
+}
+
+func (s *Server) getSettings(w http.ResponseWriter, names string) {
+	ns, err := s.resolve(names)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "index_not_found_exception", err.Error())
+		return
+	}
+	res := make(map[string]interface{})
+	for _, n := range ns {
+		settings := s.indices[n].settings
+		if settings == nil {
+			settings = map[string]interface{}{}
+		}
+		res[n] = map[string]interface{}{"settings": settings}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) getMapping(w http.ResponseWriter, names string, typ string) {
+	ns, err := s.resolve(names)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "index_not_found_exception", err.Error())
+		return
+	}
+	res := make(map[string]interface{})
+	for _, n := range ns {
+		ms := make(map[string]interface{})
+		for t, m := range s.indices[n].mappings {
+			if typ == "" || t == typ {
+				ms[t] = m
+			}
+		}
+		res[n] = map[string]interface{}{"mappings": ms}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// putMapping merges the mapping into the existing one: new properties are
+// added, the other top level keys (e.g. "_meta") replaced
+func (s *Server) putMapping(w http.ResponseWriter, names string, typ string, body []byte) {
+	ns, err := s.resolve(names)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "index_not_found_exception", err.Error())
+		return
+	}
+	var req map[string]map[string]interface{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "mapper_parsing_exception", err.Error())
+		return
+	}
+	m, ok := req[typ]
+	if !ok {
+		m = map[string]interface{}{}
+		if err := json.Unmarshal(body, &m); err != nil {
+			writeError(w, http.StatusBadRequest, "mapper_parsing_exception", err.Error())
+			return
+		}
+	}
+	for _, n := range ns {
+		old, ok := s.indices[n].mappings[typ]
+		if !ok {
+			old = make(map[string]interface{})
+			s.indices[n].mappings[typ] = old
+		}
+		for k, v := range m {
+			if k != "properties" {
+				old[k] = v
+				continue
+			}
+			ps, _ := old[k].(map[string]interface{})
+			if ps == nil {
+				ps = make(map[string]interface{})
+				old[k] = ps
+			}
+			if vs, ok := v.(map[string]interface{}); ok {
+				for p, x := range vs {
+					ps[p] = x
+				}
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"acknowledged": true})
+}
+
+func (s *Server) count(w http.ResponseWriter, names string, typ string, body []byte) {
+	hs, err := s.match(names, typ, body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "search_phase_execution_exception", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"count":   len(hs),
+		"_shards": map[string]int{"total": 1, "successful": 1, "failed": 0},
+	})
+}
+
+func (s *Server) health(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"cluster_name":          "estest",
+		"status":                "green",
+		"timed_out":             false,
+		"number_of_nodes":       1,
+		"number_of_data_nodes":  1,
+		"active_primary_shards": len(s.indices),
+		"active_shards":         len(s.indices),
+	})
+}
+
+func (s *Server) bulk(w http.ResponseWriter, body []byte) {
+	var items []map[string]interface{}
+	errors := false
+
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	sc.Buffer(make([]byte, 64*1024), len(body)+1)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var action map[string]struct {
+			Index string `json:"_index"`
+			Type  string `json:"_type"`
+			ID    string `json:"_id"`
+		}
+		if err := json.Unmarshal(line, &action); err != nil {
+			writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+			return
+		}
+		for op, meta := range action {
+			var source []byte
+			if op != "delete" {
+				if !sc.Scan() {
+					writeError(w, http.StatusBadRequest, "parse_exception", "missing source")
+					return
+				}
+				source = append([]byte(nil), sc.Bytes()...)
+			}
+			item := map[string]interface{}{"_index": meta.Index, "_type": meta.Type, "_id": meta.ID}
+			if reason, ok := s.rejected[meta.ID]; ok {
+				errors = true
+				item["status"] = http.StatusBadRequest
+				item["error"] = map[string]interface{}{"type": "mapper_parsing_exception", "reason": reason}
+				items = append(items, map[string]interface{}{op: item})
+				continue
+			}
+			switch op {
+			case "index", "create":
+				d, created := s.put(s.create(meta.Index, nil), meta.Type, meta.ID, source)
+				item["_id"] = d.ID
+				item["_version"] = d.Version
+				item["status"] = http.StatusOK
+				if created {
+					item["status"] = http.StatusCreated
+				}
+			case "delete":
+				item["status"] = http.StatusNotFound
+				if ix, ok := s.indices[meta.Index]; ok {
+					if _, ok := ix.docs[meta.ID]; ok {
+						delete(ix.docs, meta.ID)
+						item["status"] = http.StatusOK
+					}
+				}
+			default:
+				errors = true
+				item["status"] = http.StatusBadRequest
+				item["error"] = map[string]interface{}{"type": "illegal_argument_exception", "reason": "estest: " + op + " not supported"}
+			}
+			items = append(items, map[string]interface{}{op: item})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"took": 1, "errors": errors, "items": items})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error the way Elasticsearch 2.x does
+func writeError(w http.ResponseWriter, status int, typ string, reason string) {
+	e := map[string]interface{}{"type": typ, "reason": reason}
+	writeJSON(w, status, map[string]interface{}{
+		"error":  map[string]interface{}{"root_cause": []interface{}{e}, "type": typ, "reason": reason},
+		"status": status,
+	})
+}
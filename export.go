@@ -0,0 +1,179 @@
+package elasticbook
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"gopkg.in/olivere/elastic.v3"
+)
+
+// Exporter writes out bookmarks, one at a time
+type Exporter interface {
+	// Write adds a bookmark
+	Write(b *BookmarkIndexable) error
+	// Close flushes what's left (it does not close the underlying writer)
+	Close() error
+}
+
+// Scan is ScanContext with a background context
+func (c *Client) Scan(name string, fn func(id string, b *BookmarkIndexable) error) error {
+	return c.ScanContext(context.Background(), name, fn)
+}
+
+// ScanContext scrolls through an index (or an alias) calling fn for every
+// bookmark, with its document ID. It stops at the first error fn returns.
+func (c *Client) ScanContext(ctx context.Context, name string, fn func(id string, b *BookmarkIndexable) error) error {
+	ctx, cancel := withTimeout(ctx, c.indexTimeout)
+	defer cancel()
+
+	client := c.client
+
+	scroll := client.Scroll(name).Type(TypeName).Size(c.bulkActions)
+	for {
+		sr, err := scroll.DoC(ctx)
+		if err == elastic.EOS {
+			return nil
+		}
+		if err != nil {
+			return wrapError(err)
+		}
+		if sr.Hits == nil {
+			return nil
+		}
+		for _, hit := range sr.Hits.Hits {
+			b := new(BookmarkIndexable)
+			if err := json.Unmarshal(*hit.Source, b); err != nil {
+				return err
+			}
+			if err := fn(hit.Id, b); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Export is ExportContext with a background context
+func Export(b Backend, name string, e Exporter) (int, error) {
+	return ExportContext(context.Background(), b, name, e)
+}
+
+// ExportContext writes all the bookmarks of an index (or an alias) and
+// returns how many they were
+func ExportContext(ctx context.Context, b Backend, name string, e Exporter) (int, error) {
+	var n int
+	err := b.ScanContext(ctx, name, func(_ string, bm *BookmarkIndexable) error {
+		n++
+		return e.Write(bm)
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, e.Close()
+}
+
+// ExportSearchContext writes the bookmarks found by a search, all the
+// pages of it, and returns how many they were
+func ExportSearchContext(ctx context.Context, b Backend, term string, o SearchOptions, e Exporter) (int, error) {
+	var n int
+	o.Size = MaxPageSize
+	for {
+		sr, err := b.SearchWithContext(ctx, term, o)
+		if err != nil {
+			return n, err
+		}
+		for _, hit := range sr.Hits {
+			if err := e.Write(hit.Bookmark); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if sr.Next == "" {
+			return n, e.Close()
+		}
+		o.Cursor = sr.Next
+	}
+}
+
+// ExportHits writes the bookmarks of a search result set and returns how
+// many they were (a single page, see ExportSearchContext)
+func ExportHits(sr *SearchResult, e Exporter) (int, error) {
+	var n int
+	for _, hit := range sr.Hits {
+		if err := e.Write(hit.Bookmark); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, e.Close()
+}
+
+// jsonExporter writes newline delimited JSON
+type jsonExporter struct {
+	enc *json.Encoder
+}
+
+// NewJSONExporter writes a BookmarkIndexable JSON document per line
+func NewJSONExporter(w io.Writer) Exporter {
+	return &jsonExporter{enc: json.NewEncoder(w)}
+}
+
+func (e *jsonExporter) Write(b *BookmarkIndexable) error {
+	return e.enc.Encode(b)
+}
+
+func (e *jsonExporter) Close() error {
+	return nil
+}
+
+// CSVHeader are the columns written by the CSV Exporter
+var CSVHeader = []string{
+	"id", "name", "url", "folder", "root", "date_added",
+	"tags", "keyword", "source_browser", "source_profile",
+}
+
+// csvExporter writes CSV records
+type csvExporter struct {
+	w      *csv.Writer
+	header bool
+}
+
+// NewCSVExporter writes a CSV record per bookmark (see CSVHeader); tags
+// are joined with a comma
+func NewCSVExporter(w io.Writer) Exporter {
+	return &csvExporter{w: csv.NewWriter(w)}
+}
+
+func (e *csvExporter) Write(b *BookmarkIndexable) error {
+	if !e.header {
+		if err := e.w.Write(CSVHeader); err != nil {
+			return err
+		}
+		e.header = true
+	}
+	return e.w.Write([]string{
+		b.OriginalID,
+		b.Name,
+		b.URL,
+		b.Folder,
+		b.Root,
+		b.DateAdded.Format(time.RFC3339),
+		strings.Join(b.Tags, ","),
+		b.Keyword,
+		b.SourceBrowser,
+		b.SourceProfile,
+	})
+}
+
+func (e *csvExporter) Close() error {
+	if !e.header {
+		if err := e.w.Write(CSVHeader); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
@@ -0,0 +1,246 @@
+// Package firefox imports the Firefox bookmarks (places.sqlite) into the
+// elasticbook Bookmarks tree, so that they can be indexed as the Chrome
+// ones.
+package firefox
+
+import (
+	"crypto/md5"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	// The sqlite3 driver (it needs cgo)
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/zeroed/elasticbook"
+)
+
+// Root GUIDs of the Firefox bookmarks tree
+const (
+	menuGUID    = "menu________"
+	toolbarGUID = "toolbar_____"
+	unfiledGUID = "unfiled_____"
+	mobileGUID  = "mobile______"
+	tagsGUID    = "tags________"
+)
+
+// moz_bookmarks.type values
+const (
+	typeBookmark = 1
+	typeFolder   = 2
+)
+
+// chromeEpochDelta is the number of microseconds between 1601/01/01 (the
+// Chrome epoch) and 1970/01/01 (the Firefox PRTime epoch)
+const chromeEpochDelta = 11644473600000000
+
+// placesQuery joins the bookmarks with their URL and keyword.
+// Since Firefox 39 the keywords are bound to the place (place_id).
+const placesQuery = `
+SELECT b.id, b.type, IFNULL(b.fk, 0), IFNULL(b.parent, 0),
+       IFNULL(b.title, ''), IFNULL(b.dateAdded, 0), IFNULL(b.lastModified, 0),
+       IFNULL(b.guid, ''), IFNULL(p.url, ''), IFNULL(k.keyword, '')
+FROM moz_bookmarks b
+LEFT JOIN moz_places p ON p.id = b.fk
+LEFT JOIN moz_keywords k ON k.place_id = b.fk
+ORDER BY b.parent, b.position`
+
+// node is a row of moz_bookmarks
+type node struct {
+	id           int64
+	kind         int
+	fk           int64
+	parent       int64
+	title        string
+	dateAdded    int64
+	lastModified int64
+	guid         string
+	url          string
+	keyword      string
+	children     []*node
+}
+
+// Parse reads a places.sqlite file and returns the same tree Chrome
+// would have: the toolbar is the "Bookmarks Bar", the mobile bookmarks
+// are the "Mobile Bookmarks" and the unfiled ones the "Other Bookmarks"
+// (with the "Bookmarks Menu" as a subfolder).
+// Tags and keywords are attached to the bookmarks.
+// The Checksum is an md5 of the rows read: it changes with the bookmarks
+// (not with the history), so that Sync can tell if there is something
+// to do.
+// A running Firefox locks the database and keeps the last changes in its
+// write-ahead log (places.sqlite-wal): the file and its log are copied
+// to a temporary directory, and the copy is read.
+func Parse(path string) (*elasticbook.Root, error) {
+	dir, err := ioutil.TempDir("", "elasticbook-places")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	cp := filepath.Join(dir, "places.sqlite")
+	if err := copyFile(path, cp); err != nil {
+		return nil, err
+	}
+	if err := copyFile(path+"-wal", cp+"-wal"); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	u := url.URL{Scheme: "file", Path: cp}
+
+	db, err := sql.Open("sqlite3", u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(placesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	h := md5.New()
+	nodes := make(map[int64]*node)
+	var ordered []*node
+	for rows.Next() {
+		n := new(node)
+		err := rows.Scan(&n.id, &n.kind, &n.fk, &n.parent, &n.title,
+			&n.dateAdded, &n.lastModified, &n.guid, &n.url, &n.keyword)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(h, "%d %d %d %d %q %d %d %q %q %q\n",
+			n.id, n.kind, n.fk, n.parent, n.title,
+			n.dateAdded, n.lastModified, n.guid, n.url, n.keyword)
+		if _, ok := nodes[n.id]; ok {
+			// More keywords for the same place: the first one wins
+			continue
+		}
+		nodes[n.id] = n
+		ordered = append(ordered, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	roots := make(map[string]*node)
+	for _, n := range ordered {
+		if p, ok := nodes[n.parent]; ok && p != n {
+			p.children = append(p.children, n)
+		}
+		switch n.guid {
+		case menuGUID, toolbarGUID, unfiledGUID, mobileGUID, tagsGUID:
+			roots[n.guid] = n
+		}
+	}
+
+	tags := make(map[int64][]string)
+	if t, ok := roots[tagsGUID]; ok {
+		for _, tag := range t.children {
+			for _, b := range tag.children {
+				tags[b.fk] = append(tags[b.fk], tag.title)
+			}
+		}
+		for fk := range tags {
+			sort.Strings(tags[fk])
+		}
+	}
+
+	r := new(elasticbook.Root)
+	r.Version = 1
+	r.Checksum = fmt.Sprintf("%x", h.Sum(nil))
+	r.Roots.BookmarkBar = base(roots[toolbarGUID], "Bookmarks Bar", tags)
+	r.Roots.Synced = base(roots[mobileGUID], "Mobile Bookmarks", tags)
+	r.Roots.Other = base(roots[unfiledGUID], "Other Bookmarks", tags)
+	if m, ok := roots[menuGUID]; ok && len(m.children) > 0 {
+		menu := bookmark(m, tags)
+		menu.Name = "Bookmarks Menu"
+		r.Roots.Other.Children = append([]elasticbook.Bookmark{*menu},
+			r.Roots.Other.Children...)
+	}
+
+	return r, nil
+}
+
+// copyFile copies the file src to dst
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// base converts a root folder (it may be missing in old databases)
+func base(n *node, name string, tags map[int64][]string) elasticbook.Base {
+	b := elasticbook.Base{
+		Name:     name,
+		NodeType: elasticbook.FolderNodeType,
+	}
+	if n == nil {
+		return b
+	}
+	b.DateAdded = chromeTime(n.dateAdded)
+	b.DataModified = chromeTime(n.lastModified)
+	b.ID = n.guid
+	b.Children = children(n, tags)
+	return b
+}
+
+func children(n *node, tags map[int64][]string) []elasticbook.Bookmark {
+	var bs []elasticbook.Bookmark
+	for _, c := range n.children {
+		if b := bookmark(c, tags); b != nil {
+			bs = append(bs, *b)
+		}
+	}
+	return bs
+}
+
+// bookmark converts a node (nil for separators)
+func bookmark(n *node, tags map[int64][]string) *elasticbook.Bookmark {
+	b := &elasticbook.Bookmark{
+		DateAdded:    chromeTime(n.dateAdded),
+		DateModified: chromeTime(n.lastModified),
+		OriginalID:   n.guid,
+		Name:         n.title,
+	}
+	if b.OriginalID == "" {
+		b.OriginalID = strconv.FormatInt(n.id, 10)
+	}
+
+	switch n.kind {
+	case typeFolder:
+		b.Type = elasticbook.FolderNodeType
+		b.Children = children(n, tags)
+	case typeBookmark:
+		b.Type = elasticbook.URLNodeType
+		b.URL = n.url
+		b.Keyword = n.keyword
+		b.Tags = tags[n.fk]
+	default:
+		return nil
+	}
+	return b
+}
+
+// chromeTime converts a PRTime (microseconds from 1970/01/01) in the
+// Chrome format (microseconds from 1601/01/01, as a string)
+func chromeTime(prtime int64) string {
+	return strconv.FormatInt(prtime+chromeEpochDelta, 10)
+}
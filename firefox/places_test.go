@@ -0,0 +1,126 @@
+package firefox_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zeroed/elasticbook"
+	"github.com/zeroed/elasticbook/firefox"
+)
+
+// dateAdded is the 1450000000000000 PRTime of the fixture, in the Chrome
+// format
+const dateAdded = "13094473600000000"
+
+func TestParse(t *testing.T) {
+	r, err := firefox.Parse(filepath.Join("testdata", "places.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bar := []elasticbook.Bookmark{
+		{
+			OriginalID: "bookmark_go_", Name: "The Go Programming Language",
+			URL: "https://golang.org/", Type: elasticbook.URLNodeType,
+			Keyword: "go", Tags: []string{"go", "lang"},
+			DateAdded: dateAdded, DateModified: dateAdded,
+		},
+		{
+			OriginalID: "folder_work_", Name: "Work", Type: elasticbook.FolderNodeType,
+			DateAdded: dateAdded, DateModified: dateAdded,
+			Children: []elasticbook.Bookmark{{
+				OriginalID: "bookmark_gbe", Name: "Go by Example",
+				URL: "https://gobyexample.com/", Type: elasticbook.URLNodeType,
+				Tags:      []string{"go"},
+				DateAdded: dateAdded, DateModified: dateAdded,
+			}},
+		},
+	}
+	if got := r.Roots.BookmarkBar.Children; !reflect.DeepEqual(got, bar) {
+		t.Errorf("Bookmarks Bar = %+v, want %+v", got, bar)
+	}
+
+	var names []string
+	r.Walk(func(b *elasticbook.Bookmark, l elasticbook.Location) {
+		names = append(names, l.Root+"/"+l.Folder()+"/"+b.Name)
+	})
+	want := []string{
+		"bookmark_bar/Bookmarks Bar/The Go Programming Language",
+		"bookmark_bar/Bookmarks Bar/Work/Go by Example",
+		"other/Other Bookmarks/Bookmarks Menu/Mozilla",
+		"other/Other Bookmarks/Elasticsearch",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Walk() = %v, want %v", names, want)
+	}
+
+	if r.Checksum == "" {
+		t.Error("Checksum is empty")
+	}
+	again, err := firefox.Parse(filepath.Join("testdata", "places.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Checksum != r.Checksum {
+		t.Errorf("Checksum = %q, then %q: want the same", r.Checksum, again.Checksum)
+	}
+}
+
+// TestParseWAL checks that the bookmarks still in the write-ahead log of
+// a running Firefox are read, and change the Checksum
+func TestParseWAL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elasticbook-firefox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "places.sqlite")
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "places.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	before, err := firefox.Parse(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Firefox keeps the database open, without checkpoints
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, q := range []string{
+		"PRAGMA wal_autocheckpoint = 0",
+		"INSERT INTO moz_places (id, url, title) VALUES (5, 'https://play.golang.org/', 'The Go Playground')",
+		"INSERT INTO moz_bookmarks (id, type, fk, parent, position, title, dateAdded, lastModified, guid) " +
+			"VALUES (30, 1, 5, 6, 0, 'The Go Playground', 1450000000000000, 1450000000000000, 'bookmark_pla')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := firefox.Parse(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(r.Roots.Synced.Children); n != 1 {
+		t.Fatalf("Mobile Bookmarks has %d bookmarks, want 1", n)
+	}
+	if got := r.Roots.Synced.Children[0].Name; got != "The Go Playground" {
+		t.Errorf("Mobile Bookmarks = %q, want %q", got, "The Go Playground")
+	}
+	if r.Checksum == before.Checksum {
+		t.Errorf("Checksum = %q, unchanged by the new bookmark", r.Checksum)
+	}
+}
@@ -0,0 +1,116 @@
+package firefox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/zeroed/elasticbook/utils"
+)
+
+const (
+	// BrowserName tags the Firefox profiles and sources
+	BrowserName = "firefox"
+
+	// PlacesFileEnv is the env var with an explicit places.sqlite path
+	PlacesFileEnv = "ELASTICBOOK_FIREFOX"
+
+	// placesFileName is the name of the bookmarks database in a profile
+	placesFileName = "places.sqlite"
+)
+
+// ProfilesDir returns the directory containing the Firefox profiles:
+//   - Linux:   ~/.mozilla/firefox
+//   - OSX:     ~/Library/Application Support/Firefox/Profiles
+//   - Windows: %APPDATA%\Mozilla\Firefox\Profiles
+func ProfilesDir() (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(u.HomeDir, "Library", "Application Support",
+			"Firefox", "Profiles"), nil
+	case "windows":
+		base := os.Getenv("APPDATA")
+		if base == "" {
+			base = filepath.Join(u.HomeDir, "AppData", "Roaming")
+		}
+		return filepath.Join(base, "Mozilla", "Firefox", "Profiles"), nil
+	default:
+		return filepath.Join(u.HomeDir, ".mozilla", "firefox"), nil
+	}
+}
+
+// Profiles returns the Firefox profiles (e.g. "abcd1234.default-release")
+// with a places.sqlite file
+func Profiles() ([]utils.Profile, error) {
+	dir, err := ProfilesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		// Not installed
+		return nil, nil
+	}
+
+	var ps []utils.Profile
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name(), placesFileName)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		ps = append(ps, utils.Profile{Browser: BrowserName, Name: fi.Name(), Path: path})
+	}
+
+	sort.Slice(ps, func(i, j int) bool { return ps[i].Name < ps[j].Name })
+	return ps, nil
+}
+
+// FindProfile returns the profile named name, or containing it (Firefox
+// prefixes the names with a random string). An empty name picks the
+// first "default" profile.
+func FindProfile(name string) (utils.Profile, error) {
+	if name == "" || name == utils.DefaultProfile {
+		name = "default"
+	}
+
+	ps, err := Profiles()
+	if err != nil {
+		return utils.Profile{}, err
+	}
+
+	for _, p := range ps {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+	}
+	for _, p := range ps {
+		if strings.Contains(strings.ToLower(p.Name), strings.ToLower(name)) {
+			return p, nil
+		}
+	}
+
+	return utils.Profile{}, fmt.Errorf("No Firefox profile %q found", name)
+}
+
+// ProfileOf returns the profile a places.sqlite file belongs to
+func ProfileOf(path string) utils.Profile {
+	return utils.Profile{
+		Browser: BrowserName,
+		Name:    filepath.Base(filepath.Dir(path)),
+		Path:    path,
+	}
+}
@@ -0,0 +1,58 @@
+-- The fixture places.sqlite: a trimmed Firefox schema with a few
+-- bookmarks. Rebuild it with
+--   rm places.sqlite && sqlite3 places.sqlite < places.sql
+CREATE TABLE moz_places (
+  id INTEGER PRIMARY KEY,
+  url LONGVARCHAR,
+  title LONGVARCHAR
+);
+CREATE TABLE moz_bookmarks (
+  id INTEGER PRIMARY KEY,
+  type INTEGER,
+  fk INTEGER DEFAULT NULL,
+  parent INTEGER,
+  position INTEGER,
+  title LONGVARCHAR,
+  keyword_id INTEGER,
+  folder_type TEXT,
+  dateAdded INTEGER,
+  lastModified INTEGER,
+  guid TEXT
+);
+CREATE TABLE moz_keywords (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  keyword TEXT UNIQUE,
+  place_id INTEGER,
+  post_data TEXT
+);
+
+INSERT INTO moz_places (id, url, title) VALUES
+  (1, 'https://golang.org/', 'The Go Programming Language'),
+  (2, 'https://gobyexample.com/', 'Go by Example'),
+  (3, 'https://www.elastic.co/', 'Elasticsearch'),
+  (4, 'https://www.mozilla.org/', 'Mozilla');
+
+-- 1450000000000000 is 2015-12-13T09:46:40Z (PRTime, microseconds)
+INSERT INTO moz_bookmarks (id, type, fk, parent, position, title, dateAdded, lastModified, guid) VALUES
+  (1, 2, NULL, 0, 0, '', 1450000000000000, 1450000000000000, 'root________'),
+  (2, 2, NULL, 1, 0, 'menu', 1450000000000000, 1450000000000000, 'menu________'),
+  (3, 2, NULL, 1, 1, 'toolbar', 1450000000000000, 1450000000000000, 'toolbar_____'),
+  (4, 2, NULL, 1, 2, 'tags', 1450000000000000, 1450000000000000, 'tags________'),
+  (5, 2, NULL, 1, 3, 'unfiled', 1450000000000000, 1450000000000000, 'unfiled_____'),
+  (6, 2, NULL, 1, 4, 'mobile', 1450000000000000, 1450000000000000, 'mobile______'),
+  -- the toolbar: a bookmark and the Work folder
+  (10, 1, 1, 3, 0, 'The Go Programming Language', 1450000000000000, 1450000000000000, 'bookmark_go_'),
+  (11, 2, NULL, 3, 1, 'Work', 1450000000000000, 1450000000000000, 'folder_work_'),
+  (12, 1, 2, 11, 0, 'Go by Example', 1450000000000000, 1450000000000000, 'bookmark_gbe'),
+  (13, 3, NULL, 11, 1, '', 1450000000000000, 1450000000000000, 'separator___'),
+  -- the other bookmarks, and the menu
+  (14, 1, 3, 5, 0, 'Elasticsearch', 1450000000000000, 1450000000000000, 'bookmark_es_'),
+  (15, 1, 4, 2, 0, 'Mozilla', 1450000000000000, 1450000000000000, 'bookmark_moz'),
+  -- the tags: folders under the tags root, with a bookmark per tagged place
+  (20, 2, NULL, 4, 0, 'lang', 1450000000000000, 1450000000000000, 'tag_lang____'),
+  (21, 1, 1, 20, 0, NULL, 1450000000000000, 1450000000000000, 'tagged_go_1_'),
+  (22, 2, NULL, 4, 1, 'go', 1450000000000000, 1450000000000000, 'tag_go______'),
+  (23, 1, 1, 22, 0, NULL, 1450000000000000, 1450000000000000, 'tagged_go_2_'),
+  (24, 1, 2, 22, 1, NULL, 1450000000000000, 1450000000000000, 'tagged_gbe__');
+
+INSERT INTO moz_keywords (keyword, place_id) VALUES ('go', 1);
@@ -0,0 +1,137 @@
+package netscape
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zeroed/elasticbook"
+)
+
+const header = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file.
+     It will be read and overwritten.
+     DO NOT EDIT! -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+`
+
+// folder is a folder being rebuilt from the bookmarks paths
+type folder struct {
+	name      string
+	toolbar   bool
+	folders   []*folder
+	bookmarks []*elasticbook.BookmarkIndexable
+}
+
+func (f *folder) sub(name string) *folder {
+	for _, x := range f.folders {
+		if x.name == name {
+			return x
+		}
+	}
+	x := &folder{name: name}
+	f.folders = append(f.folders, x)
+	return x
+}
+
+// exporter collects the bookmarks and writes the whole tree on Close
+type exporter struct {
+	w    io.Writer
+	root *folder
+}
+
+// NewExporter writes a bookmarks.html file, re-creating the folder
+// structure from the bookmarks paths.
+// As Chrome does, the "Other Bookmarks" go at the top level and the
+// "Bookmarks Bar" is marked as PERSONAL_TOOLBAR_FOLDER.
+func NewExporter(w io.Writer) elasticbook.Exporter {
+	return &exporter{w: w, root: new(folder)}
+}
+
+func (e *exporter) Write(b *elasticbook.BookmarkIndexable) error {
+	f := e.root
+	for i, name := range b.Path {
+		if i == 0 && b.Root == elasticbook.OtherKey {
+			continue
+		}
+		f = f.sub(name)
+		if i == 0 && b.Root == elasticbook.BookmarkBarKey {
+			f.toolbar = true
+		}
+	}
+	f.bookmarks = append(f.bookmarks, b)
+	return nil
+}
+
+func (e *exporter) Close() error {
+	if _, err := io.WriteString(e.w, header); err != nil {
+		return err
+	}
+	return e.folder(e.root, 0)
+}
+
+func (e *exporter) folder(f *folder, depth int) error {
+	indent := strings.Repeat("    ", depth)
+	if _, err := fmt.Fprintf(e.w, "%s<DL><p>\n", indent); err != nil {
+		return err
+	}
+
+	// Toolbar first, as in the browsers
+	sort.SliceStable(f.folders, func(i, j int) bool {
+		return f.folders[i].toolbar && !f.folders[j].toolbar
+	})
+	for _, x := range f.folders {
+		attrs := ""
+		if x.toolbar {
+			attrs = ` PERSONAL_TOOLBAR_FOLDER="true"`
+		}
+		_, err := fmt.Fprintf(e.w, "%s    <DT><H3%s>%s</H3>\n",
+			indent, attrs, html.EscapeString(x.name))
+		if err != nil {
+			return err
+		}
+		if err := e.folder(x, depth+1); err != nil {
+			return err
+		}
+	}
+
+	sort.SliceStable(f.bookmarks, func(i, j int) bool {
+		return f.bookmarks[i].DateAdded.Before(f.bookmarks[j].DateAdded)
+	})
+	for _, b := range f.bookmarks {
+		_, err := fmt.Fprintf(e.w, "%s    <DT><A%s>%s</A>\n",
+			indent, attributes(b), html.EscapeString(b.Name))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(e.w, "%s</DL><p>\n", indent)
+	return err
+}
+
+// attributes returns HREF, ADD_DATE, LAST_MODIFIED, TAGS and SHORTCUTURL
+func attributes(b *elasticbook.BookmarkIndexable) string {
+	var buffer strings.Builder
+	attr := func(k, v string) {
+		if v != "" {
+			fmt.Fprintf(&buffer, ` %s="%s"`, k, html.EscapeString(v))
+		}
+	}
+
+	attr("HREF", b.URL)
+	if !b.DateAdded.IsZero() {
+		attr("ADD_DATE", strconv.FormatInt(b.DateAdded.Unix(), 10))
+	}
+	if m, err := strconv.ParseInt(b.DateModified, 10, 64); err == nil {
+		attr("LAST_MODIFIED", strconv.FormatInt((m-chromeEpochDelta)/1000000, 10))
+	}
+	attr("TAGS", strings.Join(b.Tags, ","))
+	attr("SHORTCUTURL", b.Keyword)
+	return buffer.String()
+}
@@ -0,0 +1,209 @@
+// Package netscape reads (and writes) the Netscape bookmark file format,
+// the bookmarks.html every browser and most bookmarking services can
+// export.
+package netscape
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/zeroed/elasticbook"
+)
+
+// BrowserName tags the sources read from a bookmarks.html file
+const BrowserName = "html"
+
+// HTMLFileEnv is the env var with an explicit bookmarks.html path
+const HTMLFileEnv = "ELASTICBOOK_HTML"
+
+// chromeEpochDelta is the number of microseconds between 1601/01/01 (the
+// Chrome epoch) and 1970/01/01 (the ADD_DATE epoch)
+const chromeEpochDelta = 11644473600000000
+
+// The root folder names, the same Chrome uses
+const (
+	bookmarkBarName = "Bookmarks Bar"
+	otherName       = "Other Bookmarks"
+	syncedName      = "Mobile Bookmarks"
+)
+
+// ErrMalformed is returned when a file is not a well formed Netscape
+// bookmark file (a tag left open, unbalanced <DL> lists)
+var ErrMalformed = errors.New("malformed bookmark file")
+
+// node is a folder (H3) or a bookmark (A) with its attributes
+type node struct {
+	folder   bool
+	attrs    map[string]string
+	name     string
+	children []*node
+}
+
+// Parse reads a bookmarks.html file and returns the same tree Chrome
+// would have: the folder marked PERSONAL_TOOLBAR_FOLDER is the
+// "Bookmarks Bar", everything else goes in the "Other Bookmarks".
+// ADD_DATE, LAST_MODIFIED, TAGS and ICON are kept; since there are no
+// IDs in the format, they are derived from the folder path and the URL.
+// The checksum is the MD5 of the file.
+func Parse(b []byte) (*elasticbook.Root, error) {
+	ts, err := tokenize(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	root := &node{folder: true}
+	stack := []*node{root}
+	var last *node
+	var text *string
+	var seen bool
+
+	for _, t := range ts {
+		top := stack[len(stack)-1]
+		switch t.tag {
+		case "H3":
+			f := &node{folder: true, attrs: t.attrs}
+			top.children = append(top.children, f)
+			last = f
+			text = &f.name
+		case "A":
+			a := &node{attrs: t.attrs}
+			top.children = append(top.children, a)
+			text = &a.name
+		case "/H3", "/A", "DD", "/DT":
+			text = nil
+		case "DL":
+			seen = true
+			if last != nil {
+				stack = append(stack, last)
+				last = nil
+			} else {
+				stack = append(stack, top)
+			}
+		case "/DL":
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("%w: </DL> without <DL>", ErrMalformed)
+			}
+			stack = stack[:len(stack)-1]
+			last = nil
+		case "":
+			if text != nil {
+				*text += t.text
+			}
+		}
+	}
+
+	if !seen {
+		return nil, fmt.Errorf("%w: no <DL> found", ErrMalformed)
+	}
+	if len(stack) > 1 {
+		return nil, fmt.Errorf("%w: %d <DL> not closed", ErrMalformed, len(stack)-1)
+	}
+
+	r := new(elasticbook.Root)
+	r.Version = 1
+	r.Checksum = fmt.Sprintf("%x", md5.Sum(b))
+	r.Roots.BookmarkBar = base(bookmarkBarName)
+	r.Roots.Other = base(otherName)
+	r.Roots.Synced = base(syncedName)
+
+	ids := make(map[string]int)
+	for _, n := range root.children {
+		switch {
+		case n.folder && isTrue(n.attrs["PERSONAL_TOOLBAR_FOLDER"]):
+			r.Roots.BookmarkBar.Children = append(r.Roots.BookmarkBar.Children,
+				bookmarks(n.children, []string{bookmarkBarName}, ids)...)
+		case n.folder && isTrue(n.attrs["UNFILED_BOOKMARKS_FOLDER"]):
+			r.Roots.Other.Children = append(r.Roots.Other.Children,
+				bookmarks(n.children, []string{otherName}, ids)...)
+		default:
+			r.Roots.Other.Children = append(r.Roots.Other.Children,
+				bookmarks([]*node{n}, []string{otherName}, ids)...)
+		}
+	}
+
+	return r, nil
+}
+
+func base(name string) elasticbook.Base {
+	return elasticbook.Base{
+		DateAdded: chromeTime(""),
+		Name:      name,
+		NodeType:  elasticbook.FolderNodeType,
+	}
+}
+
+// bookmarks converts the nodes living in the folder path
+func bookmarks(ns []*node, path []string, ids map[string]int) []elasticbook.Bookmark {
+	bs := make([]elasticbook.Bookmark, 0, len(ns))
+	for _, n := range ns {
+		b := elasticbook.Bookmark{
+			DateAdded: chromeTime(n.attrs["ADD_DATE"]),
+			Name:      strings.TrimSpace(html.UnescapeString(n.name)),
+		}
+		if m, ok := n.attrs["LAST_MODIFIED"]; ok {
+			b.DateModified = chromeTime(m)
+		}
+
+		if n.folder {
+			b.Type = elasticbook.FolderNodeType
+			sub := append(append([]string{}, path...), b.Name)
+			b.OriginalID = id(ids, sub...)
+			b.Children = bookmarks(n.children, sub, ids)
+		} else {
+			b.Type = elasticbook.URLNodeType
+			b.URL = n.attrs["HREF"]
+			b.Icon = n.attrs["ICON"]
+			b.Keyword = n.attrs["SHORTCUTURL"]
+			b.Tags = tags(n.attrs["TAGS"])
+			b.OriginalID = id(ids, append(append([]string{}, path...), b.URL)...)
+		}
+		bs = append(bs, b)
+	}
+	return bs
+}
+
+// id derives a stable ID from the parts (e.g. the folder path and the
+// URL); duplicates get a sequence number
+func id(ids map[string]int, parts ...string) string {
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(parts, "\x00")))
+	x := strconv.FormatUint(h.Sum64(), 10)
+
+	n := ids[x]
+	ids[x] = n + 1
+	if n > 0 {
+		return fmt.Sprintf("%s-%d", x, n)
+	}
+	return x
+}
+
+// tags splits the comma separated TAGS attribute
+func tags(s string) []string {
+	var ts []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			ts = append(ts, t)
+		}
+	}
+	return ts
+}
+
+// chromeTime converts a date in seconds from 1970/01/01 in the Chrome
+// format (microseconds from 1601/01/01, as a string).
+// A missing or broken date becomes 1970/01/01.
+func chromeTime(secs string) string {
+	s, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		s = 0
+	}
+	return strconv.FormatInt(s*1000000+chromeEpochDelta, 10)
+}
+
+func isTrue(s string) bool {
+	return strings.EqualFold(s, "true")
+}
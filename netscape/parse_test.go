@@ -0,0 +1,182 @@
+package netscape_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zeroed/elasticbook"
+	"github.com/zeroed/elasticbook/netscape"
+)
+
+const header = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file. -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+`
+
+// entry is a bookmark as visited by Walk
+type entry struct {
+	Folder    string
+	Name      string
+	URL       string
+	DateAdded string
+	Tags      []string
+	Keyword   string
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		want    []entry
+		wantErr error
+	}{
+		{
+			name: "nested folders",
+			html: header + `<DL><p>
+    <DT><H3 ADD_DATE="1450000000" PERSONAL_TOOLBAR_FOLDER="true">Bookmarks bar</H3>
+    <DL><p>
+        <DT><A HREF="https://golang.org/">The Go Programming Language</A>
+        <DT><H3>Work</H3>
+        <DL><p>
+            <DT><H3>Go</H3>
+            <DL><p>
+                <DT><A HREF="https://gobyexample.com/">Go by Example</A>
+            </DL><p>
+        </DL><p>
+    </DL><p>
+    <DT><A HREF="https://www.elastic.co/">Elasticsearch</A>
+</DL><p>
+`,
+			want: []entry{
+				{Folder: "Bookmarks Bar", Name: "The Go Programming Language", URL: "https://golang.org/", DateAdded: "11644473600000000"},
+				{Folder: "Bookmarks Bar/Work/Go", Name: "Go by Example", URL: "https://gobyexample.com/", DateAdded: "11644473600000000"},
+				{Folder: "Other Bookmarks", Name: "Elasticsearch", URL: "https://www.elastic.co/", DateAdded: "11644473600000000"},
+			},
+		},
+		{
+			name: "attributes",
+			html: header + `<DL><p>
+    <DT><A HREF="https://golang.org/" ADD_DATE="1450000000" LAST_MODIFIED="1450000001" TAGS="go, lang,," SHORTCUTURL="go">Go</A>
+    <DT><a href='https://gobyexample.com/' add_date=1450000000 tags=go>Go by Example</a>
+</DL>
+`,
+			want: []entry{
+				{Folder: "Other Bookmarks", Name: "Go", URL: "https://golang.org/", DateAdded: "13094473600000000", Tags: []string{"go", "lang"}, Keyword: "go"},
+				{Folder: "Other Bookmarks", Name: "Go by Example", URL: "https://gobyexample.com/", DateAdded: "13094473600000000", Tags: []string{"go"}},
+			},
+		},
+		{
+			name: "escaped titles",
+			html: header + `<DL><p>
+    <DT><H3>R&amp;D &lt;2016&gt;</H3>
+    <DL><p>
+        <DT><A HREF="https://example.com/?a=1&amp;b=2">&quot;Tom&quot; &amp; Jerry&#39;s &#x2014; caf&eacute;</A>
+    </DL><p>
+</DL><p>
+`,
+			want: []entry{
+				{Folder: "Other Bookmarks/R&D <2016>", Name: `"Tom" & Jerry's — café`, URL: "https://example.com/?a=1&b=2", DateAdded: "11644473600000000"},
+			},
+		},
+		{
+			name: "comment and a '>' in a value",
+			html: `<!-- <DL> is not here --><DL><DT><A HREF="https://example.com/?q=a>b">x > y</A></DL>`,
+			want: []entry{
+				{Folder: "Other Bookmarks", Name: "x > y", URL: "https://example.com/?q=a>b", DateAdded: "11644473600000000"},
+			},
+		},
+		{
+			name:    "not a bookmark file",
+			html:    `{"roots": {}}`,
+			wantErr: netscape.ErrMalformed,
+		},
+		{
+			name:    "empty",
+			html:    "",
+			wantErr: netscape.ErrMalformed,
+		},
+		{
+			name:    "unterminated tag",
+			html:    header + `<DL><p><DT><A HREF="https://golang.org/`,
+			wantErr: netscape.ErrMalformed,
+		},
+		{
+			name:    "unterminated comment",
+			html:    `<DL><!-- <DT><A HREF="https://golang.org/">Go</A></DL>`,
+			wantErr: netscape.ErrMalformed,
+		},
+		{
+			name:    "unclosed list",
+			html:    header + `<DL><p><DT><H3>Work</H3><DL><p><DT><A HREF="https://golang.org/">Go</A></DL>`,
+			wantErr: netscape.ErrMalformed,
+		},
+		{
+			name:    "unopened list",
+			html:    header + `<DL><p><DT><A HREF="https://golang.org/">Go</A></DL></DL>`,
+			wantErr: netscape.ErrMalformed,
+		},
+		{
+			name:    "unquoted attribute at the end",
+			html:    `<DL><DT><A HREF=`,
+			wantErr: netscape.ErrMalformed,
+		},
+		{
+			name: "unterminated quote",
+			html: `<DL><DT><A HREF="https://golang.org/>Go</A></DL>`,
+			// the quote swallows the rest of the file
+			wantErr: netscape.ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := netscape.Parse([]byte(tt.html))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			var got []entry
+			r.Walk(func(b *elasticbook.Bookmark, l elasticbook.Location) {
+				got = append(got, entry{
+					Folder:    l.Folder(),
+					Name:      b.Name,
+					URL:       b.URL,
+					DateAdded: b.DateAdded,
+					Tags:      b.Tags,
+					Keyword:   b.Keyword,
+				})
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseTruncated cuts a file at every byte before its last </DL>:
+// Parse must not panic, and return an error
+func TestParseTruncated(t *testing.T) {
+	html := header + `<DL><p>
+    <DT><H3 ADD_DATE="1450000000">Work</H3>
+    <DL><p>
+        <DT><A HREF="https://golang.org/" TAGS="go">Go &amp; more</A>
+    </DL><p>
+</DL><p>
+`
+	end := strings.LastIndex(html, "</DL>") + len("</DL>")
+	for i := 0; i < end; i++ {
+		if _, err := netscape.Parse([]byte(html[:i])); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", html[:i])
+		}
+	}
+	if _, err := netscape.Parse([]byte(html)); err != nil {
+		t.Errorf("Parse() error = %v", err)
+	}
+}
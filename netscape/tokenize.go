@@ -0,0 +1,130 @@
+package netscape
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// token is a tag (with upper-cased name and attribute keys, "/DL" for an
+// end tag) or, with an empty tag, a piece of text
+type token struct {
+	tag   string
+	attrs map[string]string
+	text  string
+}
+
+// tokenize splits the loose HTML of a bookmark file in tokens.
+// It's not an HTML parser: the format never closes DT and P, and the
+// exporters do not agree on much else, so it just looks for tags.
+// A tag or a comment left open is an ErrMalformed.
+func tokenize(s string) ([]token, error) {
+	n := len(s)
+	var ts []token
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			ts = append(ts, token{text: s})
+			break
+		}
+		if i > 0 {
+			ts = append(ts, token{text: s[:i]})
+		}
+		s = s[i:]
+
+		if strings.HasPrefix(s, "<!--") {
+			j := strings.Index(s, "-->")
+			if j < 0 {
+				return nil, fmt.Errorf("%w: unterminated comment at %d", ErrMalformed, n-len(s))
+			}
+			s = s[j+3:]
+			continue
+		}
+
+		j := tagEnd(s)
+		if j < 0 {
+			return nil, fmt.Errorf("%w: unterminated tag at %d", ErrMalformed, n-len(s))
+		}
+		if t, ok := parseTag(s[1:j]); ok {
+			ts = append(ts, t)
+		}
+		s = s[j+1:]
+	}
+	return ts, nil
+}
+
+// tagEnd returns the index of the '>' closing the tag at the start of s,
+// skipping the quoted attribute values
+func tagEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseTag parses the inside of a tag: NAME KEY="value" KEY=value KEY
+func parseTag(s string) (token, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" || s[0] == '!' || s[0] == '?' {
+		return token{}, false
+	}
+
+	i := strings.IndexAny(s, " \t\r\n")
+	if i < 0 {
+		i = len(s)
+	}
+	t := token{
+		tag:   strings.ToUpper(strings.TrimSuffix(s[:i], "/")),
+		attrs: make(map[string]string),
+	}
+
+	s = s[i:]
+	for {
+		s = strings.TrimLeft(s, " \t\r\n/")
+		if s == "" {
+			break
+		}
+		j := strings.IndexAny(s, "= \t\r\n")
+		if j < 0 {
+			t.attrs[strings.ToUpper(s)] = ""
+			break
+		}
+		key := strings.ToUpper(s[:j])
+		s = strings.TrimLeft(s[j:], " \t\r\n")
+		if !strings.HasPrefix(s, "=") {
+			t.attrs[key] = ""
+			continue
+		}
+		s = strings.TrimLeft(s[1:], " \t\r\n")
+
+		var value string
+		if s != "" && (s[0] == '"' || s[0] == '\'') {
+			k := strings.IndexByte(s[1:], s[0])
+			if k < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:k+1], s[k+2:]
+			}
+		} else {
+			k := strings.IndexAny(s, " \t\r\n")
+			if k < 0 {
+				k = len(s)
+			}
+			value, s = s[:k], s[k:]
+		}
+		t.attrs[key] = html.UnescapeString(value)
+	}
+
+	return t, true
+}
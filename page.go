@@ -0,0 +1,136 @@
+package elasticbook
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+)
+
+// DefaultPageSize is the number of hits of a page of search results
+const DefaultPageSize = 20
+
+// MaxPageSize caps the size of a page
+const MaxPageSize = 100
+
+// Pager selects a page of search results, the same way for every
+// Backend. The hits are sorted in a stable order (see Sort and sortKey),
+// so the pages do not overlap.
+//
+// Elasticsearch 2.x has no search_after: a page is fetched with from and
+// size, and the cursor of the next page remembers the sort key of the
+// last hit seen. The hits not after it (pushed down by bookmarks indexed
+// in the meantime) are dropped. Deletions are not covered: the bookmarks
+// deleted between two pages pull the next ones up, and as many hits
+// before from are skipped. The cursor also pins the index searched by
+// the first page, so a reindex does not reshuffle the pages.
+type Pager struct {
+	// Index is the index to search: empty on the first page (the Backend
+	// resolves its default alias and sets it)
+	Index string
+	From  int
+	Size  int
+	// Sort is the order of the hits
+	Sort Sort
+
+	query uint32
+	after *sortKey
+}
+
+// cursor is the content of a cursor token (see SearchResult.Next)
+type cursor struct {
+	Query uint32   `json:"q"`
+	Index string   `json:"i"`
+	From  int      `json:"f"`
+	Size  int      `json:"s"`
+	After *sortKey `json:"a,omitempty"`
+}
+
+// NewPager returns the page asked by the options: the one of the Cursor,
+// or the Page of Size hits. A cursor of another search (or another sort)
+// is an ErrBadCursor.
+func NewPager(term string, o SearchOptions) (*Pager, error) {
+	s, err := ParseSort(string(o.Sort))
+	if err != nil {
+		return nil, err
+	}
+	o.Sort = s
+	q := queryHash(term, o)
+	if o.Cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrBadCursor, err)
+		}
+		var c cursor
+		if err := json.Unmarshal(b, &c); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrBadCursor, err)
+		}
+		if c.Query != q {
+			return nil, fmt.Errorf("%w: it belongs to another search", ErrBadCursor)
+		}
+		if c.Index == "" || c.From < 0 || c.Size < 1 || c.Size > MaxPageSize {
+			return nil, fmt.Errorf("%w: out of range", ErrBadCursor)
+		}
+		return &Pager{Index: c.Index, From: c.From, Size: c.Size, Sort: s, query: q, after: c.After}, nil
+	}
+
+	p := &Pager{Size: o.Size, Sort: s, query: q}
+	if p.Size <= 0 {
+		p.Size = DefaultPageSize
+	}
+	if p.Size > MaxPageSize {
+		p.Size = MaxPageSize
+	}
+	if o.Page > 1 {
+		p.From = (o.Page - 1) * p.Size
+	}
+	return p, nil
+}
+
+// queryHash tells the searches apart: a cursor only works with the search
+// it comes from. The time range is left out, as the relative dates move
+// from a page to the next.
+func queryHash(term string, o SearchOptions) uint32 {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%d\x00%s",
+		term, o.Folder, o.Browser, o.Profile, o.Slop, o.Sort)
+	return h.Sum32()
+}
+
+// Finish drops the hits already seen and sets the page and the cursors of
+// the result. The hits skipped after a deletion are not looked for (see
+// Pager).
+func (p *Pager) Finish(sr *SearchResult) {
+	if p.after != nil {
+		i := 0
+		for i < len(sr.Hits) && !p.after.before(keyOf(sr.Hits[i]), p.Sort) {
+			i++
+		}
+		sr.Hits = sr.Hits[i:]
+	}
+
+	sr.Page = p.From/p.Size + 1
+	sr.Size = p.Size
+	if int64(p.From+p.Size) < sr.TotalHits && len(sr.Hits) > 0 {
+		sr.Next = p.token(p.From+p.Size, keyOf(sr.Hits[len(sr.Hits)-1]))
+	}
+	if p.From > 0 {
+		from := p.From - p.Size
+		if from < 0 {
+			from = 0
+		}
+		sr.Prev = p.token(from, nil)
+	}
+}
+
+// token encodes the cursor of another page
+func (p *Pager) token(from int, after *sortKey) string {
+	b, _ := json.Marshal(cursor{
+		Query: p.query,
+		Index: p.Index,
+		From:  from,
+		Size:  p.Size,
+		After: after,
+	})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
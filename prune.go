@@ -0,0 +1,105 @@
+package elasticbook
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// indexTimeLayout is the layout of the timestamp in the index names
+// (see newIndexName)
+const indexTimeLayout = "20060102150405"
+
+// ErrNothingToKeep is returned by Prune when neither Keep nor MaxAge is
+// set (it would delete every index)
+var ErrNothingToKeep = errors.New("prune: set how many indices to keep or their max age")
+
+// PruneOptions decides which indices Prune keeps: an index survives if
+// it's one of the Keep most recent OR if it's younger than MaxAge
+type PruneOptions struct {
+	// Keep is the number of most recent indices kept (0: ignored)
+	Keep int
+	// MaxAge is the age of the oldest index kept (0: ignored)
+	MaxAge time.Duration
+	// DryRun only reports the indices that would be deleted
+	DryRun bool
+}
+
+// Prune is PruneContext with a background context
+func (c *Client) Prune(o PruneOptions) ([]string, error) {
+	return c.PruneContext(context.Background(), o)
+}
+
+// PruneContext deletes the old timestamped indices and returns their names.
+// An index holding the default alias, or any alias set by the user,
+// is never deleted.
+func (c *Client) PruneContext(ctx context.Context, o PruneOptions) ([]string, error) {
+	ctx, cancel := withTimeout(ctx, c.timeout)
+	defer cancel()
+
+	if o.Keep <= 0 && o.MaxAge <= 0 {
+		return nil, ErrNothingToKeep
+	}
+
+	ia, err := c.indexAliases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type stamped struct {
+		name string
+		t    time.Time
+	}
+	var xs []stamped
+	for k := range ia {
+		if !strings.HasPrefix(k, c.indexPrefix+"-") {
+			continue
+		}
+		t, err := time.Parse(indexTimeLayout, strings.TrimPrefix(k, c.indexPrefix+"-"))
+		if err != nil {
+			continue
+		}
+		xs = append(xs, stamped{name: k, t: t})
+	}
+
+	// Most recent first
+	sort.Slice(xs, func(i, j int) bool { return xs[i].t.After(xs[j].t) })
+
+	now := time.Now().UTC()
+	var pruned []string
+	for i, x := range xs {
+		if o.Keep > 0 && i < o.Keep {
+			continue
+		}
+		if o.MaxAge > 0 && now.Sub(x.t) < o.MaxAge {
+			continue
+		}
+		if c.protected(ia[x.name]) {
+			continue
+		}
+		pruned = append(pruned, x.name)
+	}
+
+	if o.DryRun || len(pruned) == 0 {
+		return pruned, nil
+	}
+
+	_, err = c.client.DeleteIndex(pruned...).DoC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pruned, nil
+}
+
+// protected returns true if the aliases contain the default alias or
+// an alias set by the user (anything but the ones elasticbook adds)
+func (c *Client) protected(aliases []string) bool {
+	for _, a := range aliases {
+		if a != c.indexPrefix && a != AbortedAliasName {
+			return true
+		}
+	}
+	return false
+}
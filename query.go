@@ -0,0 +1,335 @@
+package elasticbook
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/olivere/elastic.v3"
+)
+
+// Operators are the field operators of the query syntax (see ParseQuery)
+var Operators = []string{
+	"site", "tag", "folder", "source", "browser", "profile", "after", "before",
+}
+
+// Query is a parsed search query, like
+//
+//	golang site:github.com folder:Work after:2015-06 -tutorial "exact phrase"
+//
+// The words (fuzzily) and the phrases must be found in the name or the
+// URL, the excluded ones must not; the operators restrict the search as
+// the SearchOptions do.
+type Query struct {
+	Words   []string
+	Phrases []Phrase
+	// NotWords and NotPhrases are the excluded ones (-tutorial)
+	NotWords   []string
+	NotPhrases []Phrase
+	// Sites are the hosts of the URL (site:github.com): any of them
+	Sites []string
+	// Tags are the tags of the bookmark (tag:go): all of them
+	Tags []string
+	// Options are set by the folder:, source:, browser:, profile:, after:
+	// and before: operators
+	Options SearchOptions
+}
+
+// Phrase is a quoted phrase. Its words must be found in a row, unless a
+// slop is given ("go example"~1): the number of moves allowed to put
+// them in order ("Go by Example").
+type Phrase struct {
+	Text string
+	// Slop is the one given with ~N, or -1 (the SearchOptions one)
+	Slop int
+}
+
+// SlopOr returns the slop of the phrase, or dflt if none was given
+func (p Phrase) SlopOr(dflt int) int {
+	if p.Slop < 0 {
+		return dflt
+	}
+	return p.Slop
+}
+
+// ParseQuery parses the query syntax (see Query). Values and phrases
+// with spaces are quoted: folder:"Bookmarks Bar/Work". A malformed query
+// returns an ErrQuerySyntax error telling where it went wrong (a bad
+// after: or before: date an ErrUnparseableDate one).
+func ParseQuery(s string) (*Query, error) {
+	q := new(Query)
+	p := &queryParser{rs: []rune(s)}
+	for {
+		p.skipSpaces()
+		if p.eof() {
+			break
+		}
+		start := p.pos
+		not := p.next('-')
+		if p.eof() || unicode.IsSpace(p.peek()) {
+			return nil, p.errorf(start, "a lone -")
+		}
+
+		if p.peek() == '"' {
+			text, err := p.quoted()
+			if err != nil {
+				return nil, err
+			}
+			phrase := Phrase{Text: text, Slop: -1}
+			if p.next('~') {
+				if phrase.Slop, err = p.number(); err != nil {
+					return nil, err
+				}
+			}
+			if not {
+				q.NotPhrases = append(q.NotPhrases, phrase)
+			} else {
+				q.Phrases = append(q.Phrases, phrase)
+			}
+			continue
+		}
+
+		word := p.word()
+		op, ok := operator(word)
+		if !ok {
+			if not {
+				q.NotWords = append(q.NotWords, word)
+			} else {
+				q.Words = append(q.Words, word)
+			}
+			continue
+		}
+
+		if not {
+			return nil, p.errorf(start, "%s: cannot be excluded", op)
+		}
+		value := word[len(op)+1:]
+		if value == "" && !p.eof() && p.peek() == '"' {
+			var err error
+			if value, err = p.quoted(); err != nil {
+				return nil, err
+			}
+		}
+		if value == "" {
+			return nil, p.errorf(start, "%s: needs a value", op)
+		}
+		if err := q.set(op, value); err != nil {
+			return nil, fmt.Errorf("at %d: %s: %w", start+1, op, err)
+		}
+	}
+
+	if len(q.Words) == 0 && len(q.Phrases) == 0 && len(q.NotWords) == 0 &&
+		len(q.NotPhrases) == 0 && len(q.Sites) == 0 && len(q.Tags) == 0 &&
+		q.Options == (SearchOptions{}) {
+		return nil, fmt.Errorf("%w: empty query", ErrQuerySyntax)
+	}
+	return q, nil
+}
+
+// operator returns the operator of a word like "site:github.com"; an
+// unknown one is not an operator (e.g. "http://...")
+func operator(word string) (string, bool) {
+	i := strings.IndexRune(word, ':')
+	if i < 0 {
+		return "", false
+	}
+	op := strings.ToLower(word[:i])
+	for _, o := range Operators {
+		if op == o {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// set applies an operator
+func (q *Query) set(op string, value string) error {
+	var err error
+	switch op {
+	case "site":
+		q.Sites = append(q.Sites, strings.ToLower(value))
+	case "tag":
+		q.Tags = append(q.Tags, value)
+	case "folder":
+		q.Options.Folder = value
+	case "source":
+		q.Options.Browser, q.Options.Profile = ParseSource(value)
+	case "browser":
+		q.Options.Browser = value
+	case "profile":
+		q.Options.Profile = value
+	case "after":
+		q.Options.After, err = ParseDate(value, time.Now())
+	case "before":
+		q.Options.Before, err = ParseDate(value, time.Now())
+	}
+	return err
+}
+
+// queryParser scans a query, rune by rune
+type queryParser struct {
+	rs  []rune
+	pos int
+}
+
+func (p *queryParser) eof() bool {
+	return p.pos >= len(p.rs)
+}
+
+func (p *queryParser) peek() rune {
+	return p.rs[p.pos]
+}
+
+// next consumes r, if it comes next
+func (p *queryParser) next(r rune) bool {
+	if !p.eof() && p.peek() == r {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) skipSpaces() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+// word reads up to a space or a quote
+func (p *queryParser) word() string {
+	start := p.pos
+	for !p.eof() && !unicode.IsSpace(p.peek()) && p.peek() != '"' {
+		p.pos++
+	}
+	return string(p.rs[start:p.pos])
+}
+
+// number reads a (non negative) number, like the slop of a phrase
+func (p *queryParser) number() (int, error) {
+	start := p.pos
+	for !p.eof() && unicode.IsDigit(p.peek()) {
+		p.pos++
+	}
+	n, err := strconv.Atoi(string(p.rs[start:p.pos]))
+	if err != nil {
+		return 0, p.errorf(start, "~ needs a number")
+	}
+	return n, nil
+}
+
+// quoted reads a quoted string (the quotes excluded)
+func (p *queryParser) quoted() (string, error) {
+	start := p.pos
+	p.pos++
+	for !p.eof() && p.peek() != '"' {
+		p.pos++
+	}
+	if p.eof() {
+		return "", p.errorf(start, "unterminated quote")
+	}
+	s := strings.TrimSpace(string(p.rs[start+1 : p.pos]))
+	p.pos++
+	if s == "" {
+		return "", p.errorf(start, "empty quotes")
+	}
+	return s, nil
+}
+
+// errorf returns an ErrQuerySyntax error at a (rune) position, counted
+// from 1
+func (p *queryParser) errorf(pos int, format string, args ...interface{}) error {
+	return fmt.Errorf("%w at %d: %s", ErrQuerySyntax, pos+1, fmt.Sprintf(format, args...))
+}
+
+// With returns the options overridden by the ones set in the query
+func (o SearchOptions) With(q SearchOptions) SearchOptions {
+	if q.Folder != "" {
+		o.Folder = q.Folder
+	}
+	if q.Browser != "" {
+		o.Browser = q.Browser
+	}
+	if q.Profile != "" {
+		o.Profile = q.Profile
+	}
+	if !q.After.IsZero() {
+		o.After = q.After
+	}
+	if !q.Before.IsZero() {
+		o.Before = q.Before
+	}
+	return o
+}
+
+// boolQuery compiles the query into an Elasticsearch bool query, with
+// the options (overridden by the query ones) as filters. The words found
+// together in the name (see the name.shingles field) score higher.
+func (q *Query) boolQuery(o SearchOptions) *elastic.BoolQuery {
+	bq := elastic.NewBoolQuery()
+	if len(q.Words) > 0 {
+		words := strings.Join(q.Words, " ")
+		bq = bq.Must(elastic.NewMultiMatchQuery(words, DefaultFields...).
+			ZeroTermsQuery("none").
+			QueryName("elasticbookSearch").
+			PrefixLength(2).
+			Fuzziness("AUTO").
+			Type("most_fields").
+			FieldWithBoost("name", float64(2)).
+			FieldWithBoost("path.text", float64(0.5)))
+		if len(q.Words) > 1 {
+			bq = bq.Should(elastic.NewMatchQuery("name.shingles", words).Boost(2))
+		}
+	}
+	for _, p := range q.Phrases {
+		bq = bq.Must(elastic.NewMultiMatchQuery(p.Text, DefaultFields...).
+			Type("phrase").
+			Slop(p.SlopOr(o.Slop)).
+			FieldWithBoost("name", float64(2)))
+	}
+	if len(q.Words) == 0 && len(q.Phrases) == 0 {
+		bq = bq.Must(elastic.NewMatchAllQuery())
+	}
+	for _, w := range q.NotWords {
+		bq = bq.MustNot(elastic.NewMultiMatchQuery(w, DefaultFields...))
+	}
+	for _, p := range q.NotPhrases {
+		bq = bq.MustNot(elastic.NewMultiMatchQuery(p.Text, DefaultFields...).
+			Type("phrase").
+			Slop(p.SlopOr(o.Slop)))
+	}
+
+	if len(q.Sites) > 0 {
+		sq := elastic.NewBoolQuery()
+		for _, s := range q.Sites {
+			sq = sq.Should(elastic.NewMatchPhraseQuery("url", s))
+		}
+		bq = bq.Filter(sq)
+	}
+	for _, t := range q.Tags {
+		bq = bq.Filter(elastic.NewTermQuery("tags", t))
+	}
+
+	o = o.With(q.Options)
+	if o.Folder != "" {
+		bq = bq.Filter(elastic.NewTermQuery("folder", o.Folder))
+	}
+	if o.Browser != "" {
+		bq = bq.Filter(elastic.NewTermQuery("source_browser", o.Browser))
+	}
+	if o.Profile != "" {
+		bq = bq.Filter(elastic.NewTermQuery("source_profile", o.Profile))
+	}
+	if !o.After.IsZero() || !o.Before.IsZero() {
+		rq := elastic.NewRangeQuery("date_added")
+		if !o.After.IsZero() {
+			rq = rq.Gte(o.After.UTC().Format(time.RFC3339))
+		}
+		if !o.Before.IsZero() {
+			rq = rq.Lt(o.Before.UTC().Format(time.RFC3339))
+		}
+		bq = bq.Filter(rq)
+	}
+	return bq
+}
@@ -0,0 +1,82 @@
+package elasticbook_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zeroed/elasticbook"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    *elasticbook.Query
+		wantErr error
+	}{
+		{
+			query: "golang",
+			want:  &elasticbook.Query{Words: []string{"golang"}},
+		},
+		{
+			query: `golang site:github.com folder:Work after:2015-06 -tutorial "exact phrase"`,
+			want: &elasticbook.Query{
+				Words:    []string{"golang"},
+				Phrases:  []elasticbook.Phrase{{Text: "exact phrase", Slop: -1}},
+				NotWords: []string{"tutorial"},
+				Sites:    []string{"github.com"},
+				Options: elasticbook.SearchOptions{
+					Folder: "Work",
+					After:  time.Date(2015, 6, 1, 0, 0, 0, 0, time.Local),
+				},
+			},
+		},
+		{
+			query: `folder:"Bookmarks Bar/Work" -"hello world" tag:go tag:web source:chrome/Default`,
+			want: &elasticbook.Query{
+				NotPhrases: []elasticbook.Phrase{{Text: "hello world", Slop: -1}},
+				Tags:       []string{"go", "web"},
+				Options: elasticbook.SearchOptions{
+					Folder:  "Bookmarks Bar/Work",
+					Browser: "chrome",
+					Profile: "Default",
+				},
+			},
+		},
+		{
+			query: "Site:GitHub.com site:golang.org https://golang.org",
+			want: &elasticbook.Query{
+				Words: []string{"https://golang.org"},
+				Sites: []string{"github.com", "golang.org"},
+			},
+		},
+		{
+			query: `"go example"~1 -"hello world"~0`,
+			want: &elasticbook.Query{
+				Phrases:    []elasticbook.Phrase{{Text: "go example", Slop: 1}},
+				NotPhrases: []elasticbook.Phrase{{Text: "hello world", Slop: 0}},
+			},
+		},
+		{query: "", wantErr: elasticbook.ErrQuerySyntax},
+		{query: `"go example"~`, wantErr: elasticbook.ErrQuerySyntax},
+		{query: `golang "unterminated`, wantErr: elasticbook.ErrQuerySyntax},
+		{query: `""`, wantErr: elasticbook.ErrQuerySyntax},
+		{query: "golang - tutorial", wantErr: elasticbook.ErrQuerySyntax},
+		{query: "golang site:", wantErr: elasticbook.ErrQuerySyntax},
+		{query: "golang -site:github.com", wantErr: elasticbook.ErrQuerySyntax},
+		{query: "after:someday", wantErr: elasticbook.ErrUnparseableDate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := elasticbook.ParseQuery(tt.query)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseQuery(%q) error = %v, want %v", tt.query, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
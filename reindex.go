@@ -0,0 +1,89 @@
+package elasticbook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrVerificationFailed is returned by Reindex when the new index does
+// not contain all the parsed bookmarks
+var ErrVerificationFailed = errors.New("verification failed: document count mismatch")
+
+// Reindex is ReindexContext with a background context
+func (c *Client) Reindex(ss ...*Source) (*IndexReport, error) {
+	return c.ReindexContext(context.Background(), ss...)
+}
+
+// ReindexContext builds a new index, verifies it contains all the bookmarks
+// (Root.Count().Total() of every source) and then switches the default alias to it
+// in one atomic alias action.
+// If the verification fails (or ctx is done), the new index is discarded
+// and the alias stays (or goes back) where it was.
+func (c *Client) ReindexContext(ctx context.Context, ss ...*Source) (*IndexReport, error) {
+	ctx, cancel := withTimeout(ctx, c.indexTimeout)
+	defer cancel()
+
+	previous, err := c.defaultIndex(ctx)
+	if err != nil {
+		// No (or a broken) default: nothing to roll back to
+		previous = ""
+	}
+
+	report, err := c.IndexContext(ctx, ss...)
+	if err != nil {
+		return report, err
+	}
+	indexName := report.IndexName
+
+	// rollback puts the alias back (if it moved) and discards the new
+	// index, with a context of its own as ctx may be done already
+	rollback := func(moved bool, err error) (*IndexReport, error) {
+		rctx, rcancel := c.cleanupContext()
+		defer rcancel()
+		if moved && previous != "" {
+			if _, rerr := c.DefaultContext(rctx, previous); rerr != nil {
+				return report, rerr
+			}
+		}
+		if derr := c.discard(rctx, indexName); derr != nil {
+			return report, derr
+		}
+		return report, err
+	}
+
+	expected := int64(sourcesTotal(ss))
+	if err := c.verify(ctx, indexName, indexName, expected); err != nil {
+		return rollback(false, err)
+	}
+
+	if _, err := c.DefaultContext(ctx, indexName); err != nil {
+		return rollback(false, err)
+	}
+
+	if err := c.verify(ctx, c.aliasName, indexName, expected); err != nil {
+		return rollback(true, err)
+	}
+
+	return report, nil
+}
+
+// verify checks that name (an index or an alias) holds the expected
+// number of bookmarks, once indexName has been refreshed
+func (c *Client) verify(ctx context.Context, name string, indexName string, expected int64) error {
+	client := c.client
+
+	if _, err := client.Refresh(indexName).DoC(ctx); err != nil {
+		return err
+	}
+
+	n, err := client.Count(name).Type(TypeName).DoC(ctx)
+	if err != nil {
+		return err
+	}
+	if n != expected {
+		return fmt.Errorf("%w: %s has %d bookmarks, expected %d",
+			ErrVerificationFailed, name, n, expected)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package elasticbook
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Sort is an order of the search results (see SearchOptions.Sort)
+type Sort string
+
+const (
+	// SortRelevance puts the best scores first (the default)
+	SortRelevance Sort = "relevance"
+	// SortNewest puts the last bookmarks added first
+	SortNewest Sort = "newest"
+	// SortOldest puts the first bookmarks added first
+	SortOldest Sort = "oldest"
+	// SortTitle sorts by name, ignoring the case
+	SortTitle Sort = "title"
+	// SortDomain sorts by the host of the URL (without "www."), then by
+	// name
+	SortDomain Sort = "domain"
+)
+
+// Sorts are the orders of the search results, the default one first
+var Sorts = []Sort{SortRelevance, SortNewest, SortOldest, SortTitle, SortDomain}
+
+// ParseSort returns the Sort named s; the empty string is SortRelevance
+func ParseSort(s string) (Sort, error) {
+	if s == "" {
+		return SortRelevance, nil
+	}
+	for _, x := range Sorts {
+		if strings.EqualFold(s, string(x)) {
+			return x, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownSort, s)
+}
+
+// domain returns the host of a URL, lowercased and without "www." (empty
+// if there is none, like in "javascript:" bookmarklets)
+func domain(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// sortKey is what the hits are sorted by. The hits with the same key are
+// sorted by ID, so that the order is stable.
+type sortKey struct {
+	Score     float64   `json:"s"`
+	DateAdded time.Time `json:"d"`
+	Title     string    `json:"t,omitempty"`
+	Domain    string    `json:"o,omitempty"`
+	ID        string    `json:"i"`
+}
+
+func keyOf(h *SearchHit) *sortKey {
+	return &sortKey{
+		Score:     h.Score,
+		DateAdded: h.Bookmark.DateAdded,
+		Title:     strings.ToLower(h.Bookmark.Name),
+		Domain:    h.Bookmark.Domain,
+		ID:        h.ID,
+	}
+}
+
+// before tells if k comes first in the order s of the hits
+func (k *sortKey) before(o *sortKey, s Sort) bool {
+	switch s {
+	case SortRelevance:
+		if k.Score != o.Score {
+			return k.Score > o.Score
+		}
+		fallthrough
+	case SortNewest:
+		if !k.DateAdded.Equal(o.DateAdded) {
+			return k.DateAdded.After(o.DateAdded)
+		}
+	case SortOldest:
+		if !k.DateAdded.Equal(o.DateAdded) {
+			return k.DateAdded.Before(o.DateAdded)
+		}
+	case SortDomain:
+		if k.Domain != o.Domain {
+			// the bookmarks without a domain go last
+			return o.Domain == "" || k.Domain != "" && k.Domain < o.Domain
+		}
+		fallthrough
+	case SortTitle:
+		if k.Title != o.Title {
+			return k.Title < o.Title
+		}
+	}
+	return k.ID < o.ID
+}
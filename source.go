@@ -0,0 +1,85 @@
+package elasticbook
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Source is a parsed Bookmarks tree and the browser profile it comes
+// from (both empty for a file picked by hand)
+type Source struct {
+	Browser string
+	Profile string
+	Root    *Root
+}
+
+// NewSource tags a parsed Bookmarks tree with its browser and profile
+func NewSource(browser string, profile string, r *Root) *Source {
+	return &Source{Browser: browser, Profile: profile, Root: r}
+}
+
+// ParseSource splits a "browser/profile" string (e.g. "chrome/Profile 1"
+// or just "chrome")
+func ParseSource(s string) (browser string, profile string) {
+	xs := strings.SplitN(s, PathSeparator, 2)
+	browser = xs[0]
+	if len(xs) > 1 {
+		profile = xs[1]
+	}
+	return
+}
+
+func (s *Source) String() string {
+	if s.tagged() {
+		return fmt.Sprintf("%s%s%s", s.Browser, PathSeparator, s.Profile)
+	}
+	return ""
+}
+
+// Walk visits every URL node of the tree, with the Location tagged with
+// the browser and profile
+func (s *Source) Walk(fn func(b *Bookmark, l Location)) {
+	s.Root.Walk(func(b *Bookmark, l Location) {
+		l.Browser = s.Browser
+		l.Profile = s.Profile
+		fn(b, l)
+	})
+}
+
+// ID returns the document ID of a bookmark: Chrome IDs are unique only
+// within a profile, so the tagged ones are prefixed with the source
+func (s *Source) ID(b *Bookmark) string {
+	if s.tagged() {
+		return fmt.Sprintf("%s:%s", s, b.OriginalID)
+	}
+	return b.OriginalID
+}
+
+func (s *Source) tagged() bool {
+	return s.Browser != "" || s.Profile != ""
+}
+
+// sourcesTotal returns the number of URL nodes in all the sources
+func sourcesTotal(ss []*Source) int {
+	var n int
+	for _, s := range ss {
+		n += s.Root.Count().Total()
+	}
+	return n
+}
+
+// sourcesChecksum combines the Chrome checksums of the sources.
+// A single untagged source keeps its own checksum.
+func sourcesChecksum(ss []*Source) string {
+	if len(ss) == 1 && !ss[0].tagged() {
+		return ss[0].Root.Checksum
+	}
+
+	xs := make([]string, len(ss))
+	for i, s := range ss {
+		xs[i] = fmt.Sprintf("%s=%s", s, s.Root.Checksum)
+	}
+	sort.Strings(xs)
+	return strings.Join(xs, ",")
+}
@@ -0,0 +1,260 @@
+package elasticbook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"gopkg.in/olivere/elastic.v3"
+)
+
+// SyncReport collects the outcome of a Sync run
+type SyncReport struct {
+	// IndexName is the index holding the default alias
+	IndexName string
+	// UpToDate is true if the checksum did not change (nothing to do)
+	UpToDate bool
+	// Added, Updated and Deleted contain the document IDs of the bookmarks
+	// (the ones the cluster acknowledged only)
+	Added   []string
+	Updated []string
+	Deleted []string
+	// Unchanged is the number of bookmarks left untouched
+	Unchanged int
+	// Failed contains the bookmarks the cluster refused
+	Failed []IndexFailure
+}
+
+// Sync is SyncContext with a background context
+func (c *Client) Sync(ss ...*Source) (*SyncReport, error) {
+	return c.SyncContext(context.Background(), ss...)
+}
+
+// SyncContext brings the index holding the default alias in line with the
+// parsed structures, without rebuilding it: if the Chrome checksums
+// changed, only the added bookmarks are indexed, the renamed/moved ones
+// updated and the removed ones deleted.
+// If ctx is done, the run stops after the pending bulk requests: the
+// checksum is left as it was, so the next Sync completes the job.
+func (c *Client) SyncContext(ctx context.Context, ss ...*Source) (*SyncReport, error) {
+	ctx, cancel := withTimeout(ctx, c.indexTimeout)
+	defer cancel()
+
+	client := c.client
+
+	indexName, err := c.defaultIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SyncReport{IndexName: indexName}
+
+	checksum, err := c.checksum(ctx, indexName)
+	if err != nil {
+		return nil, err
+	}
+	if checksum != "" && checksum == sourcesChecksum(ss) {
+		report.UpToDate = true
+		return report, nil
+	}
+
+	indexed, err := c.indexedBookmarks(ctx, indexName)
+	if err != nil {
+		return nil, err
+	}
+
+	var bulk IndexReport
+	var mu sync.Mutex
+	// sent tells, by document ID, in which list of the report a bookmark
+	// goes once its bulk request succeeded
+	sent := make(map[string]*[]string)
+
+	p, err := client.BulkProcessor().
+		Name("elasticbook-sync").
+		Workers(c.bulkWorkers).
+		BulkActions(c.bulkActions).
+		FlushInterval(c.bulkFlushInterval).
+		After(func(_ int64, rs []elastic.BulkableRequest, r *elastic.BulkResponse, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			bulk.collect(rs, r, err)
+		}).
+		Do()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range ss {
+		s.Walk(func(b *Bookmark, l Location) {
+			if ctx.Err() != nil {
+				return
+			}
+			id := s.ID(b)
+			bs, err := b.toIndexable(l)
+			if err != nil {
+				// Left as it is (or not added): the date is broken
+				delete(indexed, id)
+				mu.Lock()
+				bulk.Failed = append(bulk.Failed, IndexFailure{ID: id, Reason: err.Error()})
+				mu.Unlock()
+				return
+			}
+			old, ok := indexed[id]
+			delete(indexed, id)
+
+			if ok && !changed(old, bs) {
+				report.Unchanged++
+				return
+			}
+			if ok {
+				sent[id] = &report.Updated
+			} else {
+				sent[id] = &report.Added
+			}
+			p.Add(elastic.NewBulkIndexRequest().
+				Index(indexName).
+				Type(TypeName).
+				Id(id).
+				Doc(bs))
+		})
+	}
+
+	// If ctx is done, the bookmarks not visited are still in indexed:
+	// nothing is deleted
+	for id := range indexed {
+		if ctx.Err() != nil {
+			break
+		}
+		sent[id] = &report.Deleted
+		p.Add(elastic.NewBulkDeleteRequest().
+			Index(indexName).
+			Type(TypeName).
+			Id(id))
+	}
+
+	err = p.Close()
+	for _, id := range bulk.Succeeded {
+		if l, ok := sent[id]; ok {
+			*l = append(*l, id)
+		}
+	}
+	report.Failed = bulk.Failed
+	if err != nil {
+		return report, err
+	}
+	if err := ctx.Err(); err != nil {
+		// Keep the old checksum: the next Sync will finish the job
+		return report, err
+	}
+
+	if len(report.Failed) > 0 {
+		// Keep the old checksum: the next Sync will try again
+		return report, nil
+	}
+
+	return report, c.putChecksum(ctx, indexName, sourcesChecksum(ss))
+}
+
+// changed returns true if a bookmark has been renamed, moved or
+// modified since it was indexed
+func changed(old *BookmarkIndexable, bs *BookmarkIndexable) bool {
+	return old.Name != bs.Name ||
+		old.URL != bs.URL ||
+		old.Folder != bs.Folder ||
+		old.Root != bs.Root ||
+		old.DateModified != bs.DateModified ||
+		old.Keyword != bs.Keyword ||
+		strings.Join(old.Tags, ",") != strings.Join(bs.Tags, ",")
+}
+
+// indexedBookmarks scrolls through the index and returns the bookmarks
+// by their document ID
+func (c *Client) indexedBookmarks(ctx context.Context, indexName string) (map[string]*BookmarkIndexable, error) {
+	bs := make(map[string]*BookmarkIndexable)
+	err := c.ScanContext(ctx, indexName, func(id string, b *BookmarkIndexable) error {
+		bs[id] = b
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+// defaultIndex returns the (only) index holding the default alias:
+// ErrIndexNotFound if there is none, ErrAliasConflict if there are
+// several
+func (c *Client) defaultIndex(ctx context.Context) (string, error) {
+	ia, err := c.indexAliases(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var names []string
+	for k, vs := range ia {
+		for _, v := range vs {
+			if v == c.aliasName {
+				names = append(names, k)
+			}
+		}
+	}
+
+	switch len(names) {
+	case 0:
+		return "", fmt.Errorf("%w: alias %s is on no index", ErrIndexNotFound, c.aliasName)
+	case 1:
+		return names[0], nil
+	default:
+		return "", fmt.Errorf("%w: alias %s is on %d indices, expected 1",
+			ErrAliasConflict, c.aliasName, len(names))
+	}
+}
+
+// checksum returns the Chrome checksum of the last indexed Bookmarks
+// file, stored in the "_meta" of the mapping
+func (c *Client) checksum(ctx context.Context, indexName string) (string, error) {
+	client := c.client
+	ms, err := client.GetMapping().Index(indexName).Type(TypeName).DoC(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(ms[indexName])
+	if err != nil {
+		return "", err
+	}
+
+	var m struct {
+		Mappings map[string]struct {
+			Meta struct {
+				Checksum string `json:"checksum"`
+			} `json:"_meta"`
+		} `json:"mappings"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", err
+	}
+	return m.Mappings[TypeName].Meta.Checksum, nil
+}
+
+// putChecksum stores the Chrome checksum in the "_meta" of the mapping
+func (c *Client) putChecksum(ctx context.Context, indexName string, checksum string) error {
+	client := c.client
+	body, err := json.Marshal(map[string]interface{}{
+		TypeName: map[string]interface{}{
+			"_meta": map[string]string{"checksum": checksum},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutMapping().
+		Index(indexName).
+		Type(TypeName).
+		BodyString(string(body)).
+		DoC(ctx)
+	return err
+}
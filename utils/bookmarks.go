@@ -6,29 +6,221 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
 )
 
-// BookmarksFilePath want to guess which is the local bookmarks DB from the
-// Chrome installation.
-// This one is from my OSX, brew-installed, Chrome.
-// "/Users/edoardo/Library/Application Support/Google/Chrome/Default/Bookmarks"
-func BookmarksFilePath() string {
-	user, err := user.Current()
+const (
+	// BookmarksFileEnv is the env var with an explicit Bookmarks file path
+	BookmarksFileEnv = "ELASTICBOOK_BOOKMARKS"
+
+	// BrowserEnv is the env var with the browser to pick (e.g. "chromium")
+	BrowserEnv = "ELASTICBOOK_BROWSER"
+
+	// ProfileEnv is the env var with the profile to pick (e.g. "Profile 1")
+	ProfileEnv = "ELASTICBOOK_PROFILE"
+
+	// DefaultProfile is the profile Chrome creates first
+	DefaultProfile = "Default"
+
+	// bookmarksFileName is the name of the Bookmarks file in a profile
+	bookmarksFileName = "Bookmarks"
+)
+
+// Browser is a Chromium based browser and the places (relative to the
+// OS specific base directory) where it keeps its profiles
+type Browser struct {
+	Name    string
+	Linux   []string
+	Darwin  []string
+	Windows []string
+}
+
+// Browsers are the browsers looked for, in order of preference
+var Browsers = []Browser{
+	{
+		Name:    "chrome",
+		Linux:   []string{"google-chrome"},
+		Darwin:  []string{"Google", "Chrome"},
+		Windows: []string{"Google", "Chrome", "User Data"},
+	},
+	{
+		Name:    "chromium",
+		Linux:   []string{"chromium"},
+		Darwin:  []string{"Chromium"},
+		Windows: []string{"Chromium", "User Data"},
+	},
+	{
+		Name:    "brave",
+		Linux:   []string{"BraveSoftware", "Brave-Browser"},
+		Darwin:  []string{"BraveSoftware", "Brave-Browser"},
+		Windows: []string{"BraveSoftware", "Brave-Browser", "User Data"},
+	},
+	{
+		Name:    "edge",
+		Linux:   []string{"microsoft-edge"},
+		Darwin:  []string{"Microsoft Edge"},
+		Windows: []string{"Microsoft", "Edge", "User Data"},
+	},
+	{
+		Name:    "vivaldi",
+		Linux:   []string{"vivaldi"},
+		Darwin:  []string{"Vivaldi"},
+		Windows: []string{"Vivaldi", "User Data"},
+	},
+}
+
+// UserDataDir returns the directory containing the browser profiles:
+//   - Linux:   ~/.config/google-chrome
+//   - OSX:     ~/Library/Application Support/Google/Chrome
+//   - Windows: %LOCALAPPDATA%\Google\Chrome\User Data
+func (b Browser) UserDataDir() (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	var base string
+	var parts []string
+	switch runtime.GOOS {
+	case "darwin":
+		base = filepath.Join(u.HomeDir, "Library", "Application Support")
+		parts = b.Darwin
+	case "windows":
+		base = os.Getenv("LOCALAPPDATA")
+		if base == "" {
+			base = filepath.Join(u.HomeDir, "AppData", "Local")
+		}
+		parts = b.Windows
+	default:
+		base = os.Getenv("XDG_CONFIG_HOME")
+		if base == "" {
+			base = filepath.Join(u.HomeDir, ".config")
+		}
+		parts = b.Linux
+	}
+
+	return filepath.Join(append([]string{base}, parts...)...), nil
+}
+
+// Profile is a browser profile with a Bookmarks file
+type Profile struct {
+	Browser string
+	Name    string
+	Path    string
+}
+
+func (p Profile) String() string {
+	return fmt.Sprintf("%s/%s (%s)", p.Browser, p.Name, p.Path)
+}
+
+// Profiles returns all the profiles ("Default", "Profile 1", ...) with a
+// Bookmarks file, of all the known browsers.
+// Within a browser the "Default" profile comes first.
+func Profiles() ([]Profile, error) {
+	var ps []Profile
+	for _, b := range Browsers {
+		dir, err := b.UserDataDir()
+		if err != nil {
+			return nil, err
+		}
+
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			// Not installed
+			continue
+		}
+
+		var bps []Profile
+		for _, fi := range fis {
+			if !fi.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, fi.Name(), bookmarksFileName)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			bps = append(bps, Profile{Browser: b.Name, Name: fi.Name(), Path: path})
+		}
+
+		sort.Slice(bps, func(i, j int) bool {
+			if bps[i].Name == DefaultProfile || bps[j].Name == DefaultProfile {
+				return bps[i].Name == DefaultProfile
+			}
+			return bps[i].Name < bps[j].Name
+		})
+		ps = append(ps, bps...)
+	}
+
+	return ps, nil
+}
+
+// FindProfile returns the first profile matching browser and profile
+// name (case insensitive). An empty browser matches any browser, an
+// empty name the "Default" profile.
+func FindProfile(browser string, name string) (Profile, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+
+	ps, err := Profiles()
+	if err != nil {
+		return Profile{}, err
+	}
+
+	for _, p := range ps {
+		if browser != "" && !strings.EqualFold(p.Browser, browser) {
+			continue
+		}
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+	}
+
+	return Profile{}, fmt.Errorf(
+		"No Bookmarks found for browser %q and profile %q", browser, name)
+}
+
+// BookmarksFileFor returns the Bookmarks file path: file if not empty,
+// otherwise the one of the given browser and profile (see FindProfile)
+func BookmarksFileFor(browser string, profile string, file string) (string, error) {
+	if file != "" {
+		return file, nil
+	}
+
+	p, err := FindProfile(browser, profile)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "OS usupported? %s\n", err.Error())
+		return "", err
 	}
+	return p.Path, nil
+}
 
-	return filepath.Join(
-		user.HomeDir, "Library", "Application Support",
-		"Google", "Chrome", "Default", "Bookmarks")
+// BookmarksFilePath want to guess which is the local bookmarks DB from the
+// browser installations.
+// The ELASTICBOOK_BOOKMARKS, ELASTICBOOK_BROWSER and ELASTICBOOK_PROFILE
+// env vars pick a file, a browser or a profile.
+// With none of them, this is the "Default" Chrome profile (e.g. on OSX)
+// "/Users/edoardo/Library/Application Support/Google/Chrome/Default/Bookmarks"
+func BookmarksFilePath() (string, error) {
+	return BookmarksFileFor(
+		os.Getenv(BrowserEnv), os.Getenv(ProfileEnv), os.Getenv(BookmarksFileEnv))
 }
 
 // BookmarksFile opens and return the local Chrome bookmarks file
-func BookmarksFile() []byte {
-	b, err := ioutil.ReadFile(BookmarksFilePath())
+func BookmarksFile() ([]byte, error) {
+	path, err := BookmarksFilePath()
+	if err != nil {
+		return nil, err
+	}
+	return ReadBookmarksFile(path)
+}
+
+// ReadBookmarksFile opens and return the given bookmarks file
+func ReadBookmarksFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to load file (%s)", err.Error())
-		os.Exit(1)
+		return nil, fmt.Errorf("Unable to load file (%s)", err)
 	}
-	return b
+	return b, nil
 }
@@ -1,11 +1,12 @@
 package web
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
 	"html/template"
 	"log"
-	"os"
+	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/go-martini/martini"
@@ -31,6 +32,7 @@ type AppOptionFunc func(*App) error
 
 // App is the ElasticBook Web App (Martini powered)
 type App struct {
+	backend   elasticbook.Backend
 	templates string
 	publics   string
 	verbose   bool
@@ -62,6 +64,8 @@ type Result struct {
 	Index     int
 	URL       string
 	Title     string
+	Folder    string
+	Source    string
 	DateAdded string
 	Score     float64
 }
@@ -90,6 +94,15 @@ func SetTemplateDir(t string) AppOptionFunc {
 	}
 }
 
+// SetBackend define where the searches are made (default: the remote
+// Elasticsearch cluster)
+func SetBackend(b elasticbook.Backend) AppOptionFunc {
+	return func(a *App) error {
+		a.backend = b
+		return nil
+	}
+}
+
 // SetVerbose define the verbose logging
 func SetVerbose(vvv bool) AppOptionFunc {
 	return func(a *App) error {
@@ -103,17 +116,48 @@ type Search struct {
 	ID      int64 `db:"id"`
 	Created int64
 	Term    string `form:"term" binding:"required"`
+	Folder  string `form:"folder"`
+	Source  string `form:"source"`
+	// After and Before are date expressions (see elasticbook.ParseDate)
+	After  string `form:"after"`
+	Before string `form:"before"`
+	// Sort is the order of the results (see elasticbook.Sorts)
+	Sort string `form:"sort"`
+	// Cursor is the page (see elasticbook.SearchResult.Next)
+	Cursor string `form:"cursor"`
 }
 
-// Start open a local server
-func (a *App) Start() {
-	cl, err := elasticbook.ClientRemote()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+// pageURL returns the link to another page of the search
+func (s Search) pageURL(cursor string) string {
+	v := url.Values{}
+	v.Set("term", s.Term)
+	for k, x := range map[string]string{
+		"folder": s.Folder,
+		"source": s.Source,
+		"after":  s.After,
+		"before": s.Before,
+		"sort":   s.Sort,
+	} {
+		if x != "" {
+			v.Set(k, x)
+		}
+	}
+	v.Set("cursor", cursor)
+	return "/elasticbook/search?" + v.Encode()
+}
+
+// Start open a local server. It returns only if the backend cannot be
+// set up.
+func (a *App) Start() error {
+	if a.backend == nil {
+		cl, err := elasticbook.ClientContext("")
+		if err != nil {
+			return err
+		}
+		a.backend = cl
 	}
 
-	m := shakenNotStirred(cl, a.publics, a.templates)
+	m := shakenNotStirred(a.backend, a.publics, a.templates)
 	m.Get("/", func(r render.Render) {
 		r.Redirect("/elasticbook/")
 		return
@@ -123,11 +167,13 @@ func (a *App) Start() {
 
 		m.Get("/", a.home)
 		r.Get("/aliases", a.aliases)
+		r.Get("/search", binding.Bind(Search{}), a.search)
 		r.Post("/search", binding.Bind(Search{}), a.search)
 		r.Post("/suggest", binding.Bind(Suggest{}), a.suggest)
 	})
 
 	m.Run()
+	return nil
 }
 
 // Suggest is the data sent without pressing the key.
@@ -135,11 +181,12 @@ type Suggest struct {
 	Term string `form:"term"`
 }
 
-func (a *App) aliases(cl *elasticbook.Client, r render.Render, log *log.Logger) {
-	sr, err := cl.Aliases()
+func (a *App) aliases(cl elasticbook.Backend, req *http.Request, r render.Render, log *log.Logger) {
+	sr, err := cl.AliasesContext(req.Context())
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		log.Printf("Aliases failed: %s\n", err.Error())
+		r.HTML(errorStatus(err), "aliases", map[string]interface{}{"error": err.Error()})
+		return
 	}
 
 	list := make([]IndexAlias, len(sr))
@@ -155,54 +202,106 @@ func (a *App) aliases(cl *elasticbook.Client, r render.Render, log *log.Logger)
 	return
 }
 
-func checkErr(err error, msg string) {
-	if err != nil {
-		log.Fatalln(msg, err)
+// errorStatus maps the elasticbook errors to the HTTP status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, elasticbook.ErrClusterUnreachable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, elasticbook.ErrIndexNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, elasticbook.ErrAliasConflict):
+		return http.StatusConflict
+	case errors.Is(err, elasticbook.ErrQuerySyntax), errors.Is(err, elasticbook.ErrUnparseableDate),
+		errors.Is(err, elasticbook.ErrBadCursor), errors.Is(err, elasticbook.ErrUnknownSort):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
 	}
 }
 
 func (a *App) home(r render.Render) {
-	r.HTML(200, "list", nil)
+	r.HTML(200, "list", withForm(map[string]interface{}{}, Search{}))
 }
 
-func (a *App) search(cl *elasticbook.Client, s Search, r render.Render, log *log.Logger) {
-	sr, err := cl.Search(s.Term)
+// withForm adds to the data of the list template what the search form
+// needs: the orders of the sort dropdown, and the selected one
+func withForm(nmap map[string]interface{}, s Search) map[string]interface{} {
+	sorts := make([]string, len(elasticbook.Sorts))
+	for i, x := range elasticbook.Sorts {
+		sorts[i] = string(x)
+	}
+	nmap["sorts"] = sorts
+	nmap["sort"] = s.Sort
+	return nmap
+}
+
+func (a *App) search(cl elasticbook.Backend, s Search, req *http.Request, r render.Render, log *log.Logger) {
+	o := elasticbook.SearchOptions{Folder: s.Folder, Sort: elasticbook.Sort(s.Sort), Cursor: s.Cursor}
+	o.Browser, o.Profile = elasticbook.ParseSource(s.Source)
+	for _, d := range []struct {
+		expr string
+		t    *time.Time
+	}{{s.After, &o.After}, {s.Before, &o.Before}} {
+		if d.expr == "" {
+			continue
+		}
+		t, err := elasticbook.ParseDate(d.expr, time.Now())
+		if err != nil {
+			r.HTML(http.StatusBadRequest, "list", withForm(map[string]interface{}{"show": false, "error": err.Error()}, s))
+			return
+		}
+		*d.t = t
+	}
+	sr, err := cl.SearchWithContext(req.Context(), s.Term, o)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		log.Printf("Search %q failed: %s\n", s.Term, err.Error())
+		r.HTML(errorStatus(err), "list", withForm(map[string]interface{}{"show": false, "error": err.Error()}, s))
+		return
 	}
 
 	nmap := map[string]interface{}{"show": false, "results": nil}
-	if sr.Hits != nil {
-		log.Printf("Found a total of %d bookmarks\n", sr.Hits.TotalHits)
+	if sr.TotalHits > 0 {
+		log.Printf("Found a total of %d bookmarks\n", sr.TotalHits)
 
-		list := make([]Result, len(sr.Hits.Hits))
-		for i, hit := range sr.Hits.Hits {
-			var t elasticbook.Bookmark
-			err := json.Unmarshal(*hit.Source, &t)
-			if err != nil {
-				continue
-			}
+		first := (sr.Page - 1) * sr.Size
+		list := make([]Result, len(sr.Hits))
+		for i, hit := range sr.Hits {
+			t := hit.Bookmark
 
 			list[i] = Result{
-				Index:     i,
+				Index:     first + i,
 				Title:     t.Name,
 				URL:       t.URL,
-				DateAdded: t.DateAdded,
-				Score:     *hit.Score}
+				Folder:    t.Folder,
+				Source:    elasticbook.NewSource(t.SourceBrowser, t.SourceProfile, nil).String(),
+				DateAdded: t.DateAdded.Format(time.RFC1123),
+				Score:     hit.Score}
+		}
+		nmap = map[string]interface{}{
+			"show":    true,
+			"results": list,
+			"page":    sr.Page,
+			"total":   sr.TotalHits,
+		}
+		if sr.Next != "" {
+			nmap["next"] = s.pageURL(sr.Next)
+		}
+		if sr.Prev != "" {
+			nmap["prev"] = s.pageURL(sr.Prev)
 		}
-		nmap = map[string]interface{}{"show": true, "results": list}
 
 	}
-	r.HTML(200, "list", nmap)
+	r.HTML(200, "list", withForm(nmap, s))
 	return
 }
 
-func shakenNotStirred(cl *elasticbook.Client, publics string, templates string) *martini.ClassicMartini {
+func shakenNotStirred(cl elasticbook.Backend, publics string, templates string) *martini.ClassicMartini {
 	println(publics)
 	println(templates)
 	m := martini.Classic()
-	m.Map(cl)
+	m.MapTo(cl, (*elasticbook.Backend)(nil))
 	m.Use(martini.Static(publics))
 	m.Use(render.Renderer(render.Options{
 		Directory:       templates,
@@ -227,19 +326,27 @@ func shakenNotStirred(cl *elasticbook.Client, publics string, templates string)
 	return m
 }
 
-func (a *App) suggest(cl *elasticbook.Client, s Suggest, r render.Render, log *log.Logger) {
+// SuggestOption is a completion, shaped like the Elasticsearch ones
+type SuggestOption struct {
+	Text string `json:"text"`
+}
+
+func (a *App) suggest(cl elasticbook.Backend, s Suggest, req *http.Request, r render.Render, log *log.Logger) {
 	suggestions := map[string]interface{}{
-		"phrase":     make([]string, 0),
-		"term":       make([]string, 0),
 		"completion": make([]string, 0),
 	}
-	sgs, err := cl.Suggest(s.Term)
+	names, err := cl.SuggestContext(req.Context(), s.Term)
 	if err == nil {
-		suggestions["phrase"] = sgs["elasticbook-phrase-suggester"]
-		suggestions["term"] = sgs["elasticbook-term-suggester"]
-		suggestions["completion"] = sgs["elasticbook-completion-suggester"]
+		options := make([]SuggestOption, len(names))
+		for i, n := range names {
+			options[i] = SuggestOption{Text: n}
+		}
+		suggestions["completion"] = []map[string]interface{}{
+			{"text": s.Term, "options": options},
+		}
 		r.JSON(200, suggestions)
 	} else {
-		r.JSON(400, suggestions)
+		log.Printf("Suggest %q failed: %s\n", s.Term, err.Error())
+		r.JSON(errorStatus(err), suggestions)
 	}
 }